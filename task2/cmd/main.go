@@ -1,83 +1,604 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
 	"github.com/pozedorum/WB_project_4/task2/internal/concurrency"
+	"github.com/pozedorum/WB_project_4/task2/internal/follow"
 	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
 	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/output"
+	"github.com/pozedorum/WB_project_4/task2/internal/rewrite"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
 )
 
+// stdinName - имя файла, обозначающее стандартный ввод
+const stdinName = "-"
+
 func main() {
 	fs, fileArgs := options.ParseOptions()
-	if len(fileArgs) <= 0 {
-		fmt.Printf("grep: no files detected")
-		return
+	if fs.Command == options.CommandPlan {
+		os.Exit(planFiles(fs, fileArgs))
 	}
-	if *fs.ConcurrentMode > 0 {
+	if *fs.PlanInFlag != "" && len(fileArgs) > 0 {
+		log.Fatal("--plan-in takes files from the plan, FILE arguments are not allowed")
+	}
+	if len(fileArgs) == 0 && *fs.PlanInFlag == "" {
+		// Используем stdin
+		fileArgs = []string{stdinName}
+	}
+
+	// Проверяем шаблон до запуска воркеров
+	if _, err := grep.NewMatcher(*fs); err != nil {
+		log.Fatal(err)
+	}
+
+	searchScope, err := scope.New(fs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	planner, err := chunks.NewPlanner(*fs.ChunkSizeFlag, *fs.ConcurrentMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := fs.ChangePolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *fs.PlanInFlag != "" && (searchScope.Active() || fs.TailMode() || *fs.FollowFlag || fs.Operation() == models.OperationReplace) {
+		// Область поиска задаётся при разметке: флаги области передаются команде plan
+		log.Fatal("--plan-in cannot be combined with --since, --until, --lines, --bytes, --reverse, --tail-matches, --follow or --in-place")
+	}
+
+	if fs.Operation() == models.OperationReplace {
+		if searchScope.Active() {
+			log.Fatal("--in-place cannot be combined with --since or --until")
+		}
+		if *fs.FollowFlag {
+			log.Fatal("--in-place cannot be combined with --follow")
+		}
+		os.Exit(replaceFiles(fs, searchScope, fileArgs))
+	}
+
+	filesCount := len(fileArgs)
+	var manifest chunks.Manifest
+	if *fs.PlanInFlag != "" {
+		manifest = loadPlan(*fs.PlanInFlag, policy)
+		filesCount = len(manifest.Files)
+	}
+
+	printer, err := output.NewPrinter(os.Stdout, os.Stderr, fs, fs.WithFilename(filesCount))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var follower *follow.Follower
+	if *fs.FollowFlag {
+		if *fs.ReverseFlag || fs.RangeMode() || *fs.MultilineFlag || searchScope.Bounded() {
+			log.Fatal("--follow cannot be combined with --reverse, --from, -U, --until or a closed --lines/--bytes range")
+		}
+		// Размеры файлов фиксируются до основного поиска, дописанное потом просматривает follower
+		var paths []string
+		for _, filename := range fileArgs {
+			if filename != stdinName {
+				paths = append(paths, filename)
+			}
+		}
+		if follower, err = follow.New(fs, paths, searchScope, os.Stderr); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *fs.PlanInFlag != "" {
+		searchPlan(fs, searchScope, printer, manifest)
+	} else if *fs.ConcurrentMode > 0 {
 		// Распределённый режим
-		var files []*os.File
-
-		if len(fileArgs) == 0 {
-			// Используем stdin
-			files = append(files, os.Stdin)
-		} else {
-			// Открываем файлы
-			for _, filename := range fileArgs {
-				file, err := os.Open(filename)
+		var files []string
+		// Результаты входов, которые нельзя разбить на чанки (stdin, каналы): их ищем сразу
+		direct := make(map[string]models.FileResult)
+
+		// Файлы здесь не открываются: их откроют разметка и воркеры, когда дойдёт очередь
+		for _, filename := range fileArgs {
+			if filename == stdinName {
+				res := searchStdin(fs)
+				exitIfFound(fs, res)
+				direct[filename] = res
+				continue
+			}
+			info, err := os.Stat(filename)
+			if err != nil {
+				// При --follow файл будет просмотрен, когда появится
+				reportError(filename, err)
+				continue
+			}
+			if !info.Mode().IsRegular() {
+				res, err := searchStream(fs, filename)
 				if err != nil {
-					// log.Printf("Warning: cannot open %s: %v", filename, err)
+					reportError(filename, err)
 					continue
 				}
-				defer func() {
-					if err := file.Close(); err != nil {
-						fmt.Printf("grep: %v", err)
-					}
-				}()
-				files = append(files, file)
+				exitIfFound(fs, res)
+				direct[filename] = res
+				continue
 			}
+			files = append(files, filename)
 		}
 
-		if len(files) == 0 {
+		if len(files) == 0 && len(direct) == 0 && follower == nil {
+			if failed {
+				os.Exit(2)
+			}
 			log.Fatal("No files to process")
 		}
 
-		// Создаем мастера (например, с 4 воркерами)
-		master, err := concurrency.NewMaster(*fs.ConcurrentMode, fs)
-		if err != nil {
-			log.Fatal(err)
-		}
+		var merged []models.FileResult
+		if len(files) > 0 {
+			// Создаем мастера (например, с 4 воркерами)
+			master, err := concurrency.NewMaster(*fs.ConcurrentMode, fs, searchScope)
+			if err != nil {
+				log.Fatal(err)
+			}
 
-		// Обрабатываем файлы
-		if err := master.ProcessFilesStreaming(files, "grep", fs.Pattern); err != nil {
-			log.Fatal(err)
+			// Обрабатываем файлы
+			if err := master.ProcessFilesStreaming(files, "grep", fs.Pattern); err != nil {
+				log.Fatal(err)
+			}
+			if *fs.QuietFlag && master.Found() {
+				os.Exit(0)
+			}
+			// Блоки --from/--to, переходящие через границу чанков, видны только после сборки
+			merged = master.MergeFiles()
 		}
 
-		// Выводим результаты
-		results := master.MergeResults()
-		for _, line := range results {
-			fmt.Println(line)
+		// Выводим результаты в порядке аргументов
+		for _, filename := range fileArgs {
+			res, ok := direct[filename]
+			switch {
+			case ok:
+				delete(direct, filename)
+			case len(merged) > 0 && merged[0].FilePath == filename:
+				res, merged = merged[0], merged[1:]
+			default:
+				continue
+			}
+			exitIfFound(fs, res)
+			printFile(printer, fs, res)
+		}
+		for _, res := range merged {
+			exitIfFound(fs, res)
+			printFile(printer, fs, res)
 		}
 
 	} else {
 		// Обработка файла (аргумент - имя файла)
 		for _, fileName := range fileArgs {
+			if fileName == stdinName {
+				res := searchStdin(fs)
+				exitIfFound(fs, res)
+				printFile(printer, fs, res)
+				continue
+			}
+
 			file, err := os.Open(fileName)
 			if err != nil {
-				log.Fatalf("grep: %s: %v", file.Name(), err)
+				// Остальные файлы всё равно просматриваются; при --follow этот - когда появится
+				reportError(fileName, err)
+				continue
 			}
-			defer func() {
-				if err := file.Close(); err != nil {
-					fmt.Printf("grep: %v", err)
-				}
-			}()
 
-			err = grep.Grep(file, *fs, os.Stdout)
+			// Файл закрывается сразу после поиска, а не в конце программы
+			res, err := searchFile(fs, searchScope, planner, file)
+			if closeErr := file.Close(); closeErr != nil {
+				reportError(fileName, closeErr)
+			}
+			if err != nil {
+				reportError(fileName, err)
+				continue
+			}
+			exitIfFound(fs, res)
+			printFile(printer, fs, withPath(res, fileName))
+		}
+	}
+
+	if follower != nil {
+		followFiles(fs, printer, follower)
+	}
+
+	if *fs.QuietFlag {
+		// Совпадений нет: при ошибках файлов, как у grep, код 2
+		if failed {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+	if err := printer.Finish(); err != nil {
+		log.Fatal(err)
+	}
+	if failed {
+		os.Exit(2)
+	}
+}
+
+// failed - были ли ошибки чтения файлов: тогда, как у grep, код завершения 2
+var failed bool
+
+// reportError - выводит ошибку файла в stderr и запоминает её для кода завершения
+func reportError(path string, err error) {
+	fmt.Fprintf(os.Stderr, "grep: %s: %v\n", path, err)
+	failed = true
+}
+
+// followFiles - --follow: после основного поиска выводит выбранные строки, дописанные
+// в файлы, пока программу не прервут (Ctrl+C, SIGTERM). Вывод сбрасывается после
+// каждого файла, чтобы результаты сразу попадали в следующую команду конвейера
+func followFiles(fs *options.FlagStruct, printer output.Printer, follower *follow.Follower) {
+	if err := printer.Flush(); err != nil {
+		follower.Close()
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	found, err := follower.Run(ctx, func(res models.FileResult) error {
+		if err := printer.PrintFile(res); err != nil {
+			return err
+		}
+		return printer.Flush()
+	})
+	stop()
+	// Отложенные вызовы не выполняются при os.Exit и log.Fatal: закрываем сразу
+	follower.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if found {
+		os.Exit(0)
+	}
+}
+
+// planFiles - подкоманда plan: выводит в JSON план разбиения файлов на чанки, который
+// потом можно передать --plan-in. Возвращает код завершения
+func planFiles(fs *options.FlagStruct, fileArgs []string) int {
+	if len(fileArgs) == 0 {
+		fmt.Fprintln(os.Stderr, "grep: plan requires at least one file")
+		return 2
+	}
+	searchScope, err := scope.New(fs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grep: %v\n", err)
+		return 2
+	}
+
+	for _, filename := range fileArgs {
+		if filename == stdinName {
+			fmt.Fprintln(os.Stderr, "grep: cannot plan standard input")
+			return 2
+		}
+		if _, err := os.Stat(filename); err != nil {
+			fmt.Fprintf(os.Stderr, "grep: %s: %v\n", filename, err)
+			return 2
+		}
+	}
+
+	manifest, err := concurrency.PlanFiles(*fs.ConcurrentMode, fs, searchScope, fileArgs)
+	if err == nil {
+		err = chunks.WriteManifest(os.Stdout, manifest)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grep: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// loadPlan - читает план --plan-in и сверяет файлы с отпечатками по политике --on-change,
+// чтобы изменённый файл обнаружился до начала поиска
+func loadPlan(path string, policy chunks.ChangePolicy) chunks.Manifest {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifest, err := chunks.ReadManifest(file)
+	if closeErr := file.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "grep: %s: %v\n", path, closeErr)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("grep: %s: %v", path, err)
+	}
+
+	for _, planned := range manifest.Files {
+		info, err := os.Stat(planned.Path)
+		if err != nil {
+			log.Fatalf("grep: %v", err)
+		}
+		// При warn предупредят воркеры, открывая чанки
+		if _, err := planned.Fingerprint.Verify(chunks.NewFingerprint(info), policy); err != nil {
+			log.Fatalf("grep: %s: %v", planned.Path, err)
+		}
+	}
+	return manifest
+}
+
+// searchPlan - --plan-in: ищет по чанкам сохранённого плана (в нём может быть только
+// часть чанков, например при разделении работы между машинами)
+func searchPlan(fs *options.FlagStruct, searchScope *scope.Scope, printer output.Printer, manifest chunks.Manifest) {
+	if len(manifest.Chunks) == 0 {
+		return
+	}
+
+	// Результаты собираются по ID от нуля: нумеруем чанки в порядке плана
+	for i := range manifest.Chunks {
+		manifest.Chunks[i].ChunkID = i
+	}
+	// Чанки уже размечены, воркеры нужны и при -Q 0
+	master, err := concurrency.NewMaster(max(1, *fs.ConcurrentMode), fs, searchScope)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = master.ProcessChunks(manifest.Chunks, models.OperationGrep, fs.Pattern)
+	master.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *fs.QuietFlag && master.Found() {
+		os.Exit(0)
+	}
+	for _, res := range master.MergeFiles() {
+		exitIfFound(fs, res)
+		printFile(printer, fs, res)
+	}
+}
+
+// exitIfFound - при -q завершает программу с кодом 0, как только найдена выбранная строка
+func exitIfFound(fs *options.FlagStruct, res models.FileResult) {
+	if *fs.QuietFlag && len(res.Matches) > 0 {
+		os.Exit(0)
+	}
+}
+
+// replaceFiles - операция replace: переписывает совпавшие строки в файлах на месте
+// (либо выводит diff при --dry-run). Возвращает код завершения
+func replaceFiles(fs *options.FlagStruct, searchScope *scope.Scope, fileArgs []string) int {
+	if !fs.ReplaceSet {
+		fmt.Fprintln(os.Stderr, "grep: --in-place requires --replace")
+		return 2
+	}
+	if fs.RangeMode() || fs.FieldMode() {
+		fmt.Fprintln(os.Stderr, "grep: --in-place cannot be combined with --from or field selection")
+		return 2
+	}
+
+	var errs []error
+	if *fs.ConcurrentMode > 0 {
+		var files []string
+		for _, filename := range fileArgs {
+			if filename == stdinName {
+				errs = append(errs, errRewriteStdin)
+				continue
+			}
+			if _, err := os.Stat(filename); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			files = append(files, filename)
+		}
+
+		if len(files) > 0 {
+			master, err := concurrency.NewMaster(*fs.ConcurrentMode, fs, searchScope)
 			if err != nil {
 				log.Fatal(err)
 			}
+			if err := master.ProcessFilesStreaming(files, models.OperationReplace, fs.Pattern); err != nil {
+				log.Fatal(err)
+			}
+			errs = append(errs, master.RewriteErrors()...)
+		}
+	} else {
+		opts := rewrite.Options{Backup: *fs.BackupFlag, DryRun: *fs.DryRunFlag, Diff: os.Stdout}
+		for _, filename := range fileArgs {
+			if err := replaceFile(fs, filename, opts); err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
+
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "grep: %v\n", err)
+	}
+	if len(errs) > 0 {
+		return 2
+	}
+	return 0
+}
+
+// errRewriteStdin - stdin нельзя переписать на месте
+var errRewriteStdin = errors.New("cannot rewrite standard input in place")
+
+// openForReplace - открывает файл для операции replace; stdin переписать нельзя
+func openForReplace(filename string) (*os.File, error) {
+	if filename == stdinName {
+		return nil, errRewriteStdin
+	}
+	return os.Open(filename)
+}
+
+// replaceFile - переписывает один файл без разбиения на чанки
+func replaceFile(fs *options.FlagStruct, filename string, opts rewrite.Options) error {
+	file, err := openForReplace(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "grep: %s: %v\n", filename, err)
+		}
+	}()
+
+	data, changed, err := grep.Replace(context.Background(), file, *fs)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	out, err := rewrite.Create(filename, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if err := out.Write(data, changed.Matches, changed.LineCount); err != nil {
+		out.Abort()
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if err := out.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// searchFile - ищет по файлу целиком либо только по области, заданной --since/--until,
+// --lines, --bytes; при --reverse и --tail-matches файл читается с конца.
+// Номера строк и смещения считаются от начала файла
+func searchFile(fs *options.FlagStruct, searchScope *scope.Scope, planner *chunks.Planner, file *os.File) (models.FileResult, error) {
+	if !searchScope.Active() && !fs.TailMode() {
+		return grep.Search(context.Background(), file, *fs)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return models.FileResult{}, err
+	}
+	region := scope.Region{End: info.Size()}
+	if searchScope.Active() {
+		if region, err = searchScope.Resolve(file, info.Size()); err != nil {
+			return models.FileResult{}, err
+		}
+	}
+	if fs.TailMode() {
+		return searchFileReverse(fs, region, file, info.Size(), planner.ChunkSize(info.Size()))
+	}
+
+	res, err := grep.Search(context.Background(), io.NewSectionReader(file, region.Start, region.End-region.Start), *fs)
+	for i := range res.Matches {
+		res.Matches[i].LineNumber += region.LinesBefore
+		res.Matches[i].ByteOffset += region.Start
+	}
+	return res, err
+}
+
+// searchFileReverse - ищет по области файла чанками от конца к началу; при --tail-matches
+// останавливается, как только найдено нужное число выбранных строк
+func searchFileReverse(fs *options.FlagStruct, region scope.Region, file *os.File, fileSize, chunkSize int64) (models.FileResult, error) {
+	reverse := chunks.NewReverseChunks(file, region.Start, region.End, fileSize, chunkSize)
+	var parts []models.FileResult
+	found := 0
+	for *fs.TailMatchesFlag == 0 || found < *fs.TailMatchesFlag {
+		chunk, ok, err := reverse.Next(0)
+		if err != nil {
+			return models.FileResult{}, err
+		}
+		if !ok {
+			break
+		}
+
+		part, err := grep.Search(context.Background(), io.NewSectionReader(file, chunk.StartOffset, chunk.GetChunkSize()), *fs)
+		if err != nil {
+			return part, err
+		}
+		for i := range part.Matches {
+			part.Matches[i].ByteOffset += chunk.StartOffset
+		}
+		for i := range part.Edges {
+			part.Edges[i].ByteOffset += chunk.StartOffset
+		}
+		parts = append(parts, part)
+		found += grep.CountSelected(part.Matches)
+	}
+
+	// Собираем части от начала к концу; номера строк - от начала файла
+	var res models.FileResult
+	if fs.NeedLineNumbers() {
+		lines, err := chunks.CountLines(file, reverse.Offset())
+		if err != nil {
+			return res, err
+		}
+		res.LineCount = lines
+	}
+	edges := make(map[int]models.Match)
+	for i := len(parts) - 1; i >= 0; i-- {
+		for _, m := range parts[i].Matches {
+			m.LineNumber += res.LineCount
+			res.Matches = append(res.Matches, m)
+		}
+		for _, edge := range parts[i].Edges {
+			edge.LineNumber += res.LineCount
+			edges[edge.LineNumber] = edge
+		}
+		res.LineCount += parts[i].LineCount
+		res.ByteCount += parts[i].ByteCount
+		res.Elapsed += parts[i].Elapsed
+	}
+	res.Matches = grep.EdgeContext(res.Matches, edges, *fs)
+	return res, nil
+}
+
+// printFile - выводит результат файла; при --reverse и --tail-matches
+// сначала оставляет последние выбранные строки и переставляет их.
+// При -q строки не выводятся, только ошибка файла
+func printFile(printer output.Printer, fs *options.FlagStruct, res models.FileResult) {
+	if *fs.QuietFlag {
+		if res.Error != nil {
+			reportError(res.FilePath, res.Error)
+		}
+		return
+	}
+	if fs.TailMode() {
+		res = grep.Tail(res, *fs)
+	}
+	if res.Error != nil {
+		failed = true
+	}
+	if err := printer.PrintFile(res); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// searchStdin - ищет по стандартному вводу, подписывая результат именем из --label
+func searchStdin(fs *options.FlagStruct) models.FileResult {
+	res, err := grep.Search(context.Background(), os.Stdin, *fs)
+	res.Error = err
+	return withPath(res, *fs.LabelFlag)
+}
+
+// searchStream - ищет по каналу или специальному файлу целиком, как по стандартному
+// вводу: размер такого файла заранее неизвестен, на чанки он не делится
+func searchStream(fs *options.FlagStruct, filename string) (models.FileResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return models.FileResult{}, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			reportError(filename, err)
+		}
+	}()
+
+	res, err := grep.Search(context.Background(), file, *fs)
+	res.Error = err
+	return withPath(res, filename), nil
+}
+
+// withPath - проставляет имя файла результату и всем его строкам
+func withPath(res models.FileResult, path string) models.FileResult {
+	res.FilePath = path
+	for i := range res.Matches {
+		res.Matches[i].FilePath = path
+	}
+	return res
 }
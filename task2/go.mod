@@ -2,4 +2,4 @@ module github.com/pozedorum/WB_project_4/task2
 
 go 1.21.5
 
-require github.com/spf13/pflag v1.0.10 // indirect
+require github.com/spf13/pflag v1.0.10
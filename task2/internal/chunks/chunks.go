@@ -2,25 +2,30 @@ package chunks
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 )
 
 type Chunk struct {
-	FilePath    string // Путь к исходному файлу
-	StartOffset int64  // Начальное смещение в байтах
-	EndOffset   int64  // Конечное смещение в байтах
-	ChunkID     int    // Уникальный ID чанка
-	TotalChunks int    // Общее количество чанков
-	FileSize    int64  // Размер всего файла (для валидации)
+	FilePath    string      // Путь к исходному файлу
+	FileIndex   int         // Номер файла среди аргументов: файл, указанный дважды, даёт два результата
+	StartOffset int64       // Начальное смещение в байтах
+	EndOffset   int64       // Конечное смещение в байтах
+	ChunkID     int         // Уникальный ID чанка
+	TotalChunks int         // Общее количество чанков файла (0 при чтении с конца: заранее неизвестно)
+	FileSize    int64       // Размер всего файла при разметке
+	LinesBefore int         // Количество строк файла до чанка, если поиск идёт не с начала файла (--since)
+	Fingerprint Fingerprint // Отпечаток файла при разметке, сверяется при открытии чанка (Open)
 }
 
-const (
-	MaxChunkSize = 10 * 1024 * 1024 // 10MB
-)
+// MaxChunkSize - размер чанка по умолчанию и верхняя граница автоматически выбранного размера
+const MaxChunkSize = 10 * 1024 * 1024 // 10MB
 
-func SplitFiles(files []*os.File, lastChunkID int) ([]Chunk, int, error) {
+// SplitFiles - разбивает файлы на чанки размера около chunkSize по границам строк. При quoted
+// границы не попадают внутрь полей CSV в кавычках, которые могут содержать переводы строк
+func SplitFiles(files []*os.File, lastChunkID int, chunkSize int64, quoted bool) ([]Chunk, int, error) {
 	result := make([]Chunk, 0, len(files))
 	// fmt.Println("files: ", files[0].Name())
 	for _, file := range files {
@@ -31,9 +36,9 @@ func SplitFiles(files []*os.File, lastChunkID int) ([]Chunk, int, error) {
 
 		fileSize := fileInfo.Size()
 
-		if fileSize > MaxChunkSize {
-			// Большой файл - разбиваем на части по MaxChunkSize
-			fileChunks, chunksCount, err := SplitBigFile(file, lastChunkID, fileSize)
+		if fileSize > chunkSize {
+			// Большой файл - разбиваем на части по chunkSize
+			fileChunks, chunksCount, err := SplitBigFile(file, lastChunkID, fileSize, chunkSize, quoted)
 			// fmt.Printf("lastChunkID: %d, chunksCount: %d, err: %v", lastChunkID, chunksCount, err)
 			if err != nil {
 				return nil, lastChunkID, err
@@ -43,6 +48,7 @@ func SplitFiles(files []*os.File, lastChunkID int) ([]Chunk, int, error) {
 		} else {
 			// Маленький файл - один чанк
 			fileChunk := MakeChunkFromFile(file, lastChunkID, fileSize)
+			fileChunk.Fingerprint = NewFingerprint(fileInfo)
 			lastChunkID++
 			result = append(result, fileChunk)
 		}
@@ -62,41 +68,58 @@ func MakeChunkFromFile(file *os.File, chunkID int, fileSize int64) Chunk {
 	}
 }
 
-func SplitBigFile(file *os.File, startChunkID int, fileSize int64) ([]Chunk, int, error) {
-	numChunks := int(fileSize / MaxChunkSize)
-	if fileSize%MaxChunkSize != 0 {
+func SplitBigFile(file *os.File, startChunkID int, fileSize, chunkSize int64, quoted bool) ([]Chunk, int, error) {
+	return SplitRange(file, startChunkID, 0, fileSize, fileSize, chunkSize, quoted)
+}
+
+// SplitRange - разбивает на чанки часть файла [start, end); start должен быть началом строки.
+// Конец последнего чанка совпадает с end
+func SplitRange(file *os.File, startChunkID int, start, end, fileSize, chunkSize int64, quoted bool) ([]Chunk, int, error) {
+	numChunks := int((end - start) / chunkSize)
+	if (end-start)%chunkSize != 0 {
 		numChunks++
 	}
 
 	chunks := make([]Chunk, 0, numChunks)
-	currentOffset := int64(0)
+	currentOffset := start
+	fingerprint := fingerprintOf(file)
 
 	for i := 0; i < numChunks; i++ {
 		startOffset := currentOffset
-		endOffset := startOffset + MaxChunkSize
+		endOffset := startOffset + chunkSize
 
-		if endOffset > fileSize {
-			endOffset = fileSize
+		if endOffset > end {
+			endOffset = end
 		}
 
 		// Для всех чанков кроме первого корректируем начало до границы строки
 		if i > 0 {
-			adjustedStart := adjustToLineStart(file, startOffset)
-			// Если корректировка сдвинула начало за пределы конца файла, пропускаем чанк
-			if adjustedStart >= fileSize {
+			adjustedStart, err := nextLineStart(file, startOffset, fileSize)
+			if err != nil {
+				return nil, 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
+			}
+			// Если корректировка сдвинула начало за пределы конца области, пропускаем чанк
+			if adjustedStart >= end {
 				break
 			}
 			startOffset = adjustedStart
 		}
 
 		// Для всех чанков кроме последнего корректируем конец до границы строки
-		if i < numChunks-1 && endOffset < fileSize {
-			adjustedEnd := adjustToLineEnd(file, endOffset, fileSize)
-			// Если корректировка вернула ту же позицию, увеличиваем немного
-			if adjustedEnd <= endOffset {
-				adjustedEnd = adjustToLineEnd(file, endOffset+1, fileSize)
+		if i < numChunks-1 && endOffset < end {
+			var err error
+			if quoted {
+				// Чётность кавычек известна только от конца предыдущего чанка
+				endOffset, err = recordEnd(file, startOffset, endOffset, fileSize)
+			} else {
+				endOffset, err = nextLineStart(file, endOffset, fileSize)
+			}
+			if err != nil {
+				return nil, 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
 			}
-			endOffset = adjustedEnd
+		}
+		if endOffset > end {
+			endOffset = end
 		}
 
 		// Если чанк пустой, пропускаем
@@ -111,6 +134,7 @@ func SplitBigFile(file *os.File, startChunkID int, fileSize int64) ([]Chunk, int
 			ChunkID:     startChunkID + i,
 			TotalChunks: numChunks,
 			FileSize:    fileSize,
+			Fingerprint: fingerprint,
 		}
 
 		chunks = append(chunks, chunk)
@@ -120,92 +144,209 @@ func SplitBigFile(file *os.File, startChunkID int, fileSize int64) ([]Chunk, int
 		// 	chunk.ChunkID, startOffset, endOffset, endOffset-startOffset)
 	}
 
+	// Разметка могла закончиться раньше оценки numChunks: число чанков - фактическое
+	for i := range chunks {
+		chunks[i].TotalChunks = len(chunks)
+	}
 	return chunks, len(chunks), nil
 }
 
-// adjustToLineStart - находит начало первой полной строки
-func adjustToLineStart(file *os.File, offset int64) int64 {
-	if offset == 0 {
-		return 0
+// boundaryBlock - размер блока, которым читается файл при поиске границ строк
+const boundaryBlock = 64 * 1024
+
+// nextLineStart - начало первой строки, начинающейся не раньше offset (сам offset, если
+// перед ним перевод строки); fileSize, если такой строки нет. Файл читается через ReadAt:
+// его позиция не меняется, поэтому границы можно искать параллельно с чтением файла
+func nextLineStart(r io.ReaderAt, offset, fileSize int64) (int64, error) {
+	if offset <= 0 {
+		return 0, nil
+	}
+	if offset >= fileSize {
+		return fileSize, nil
 	}
 
-	// Сохраняем текущую позицию файла
-	originalPos, _ := file.Seek(0, io.SeekCurrent)
-	defer func() {
-		if _, err := file.Seek(originalPos, io.SeekStart); err != nil {
-			fmt.Printf("grep internal error: %v", err)
-		} // Восстанавливаем позицию
-	}()
-	if _, err := file.Seek(offset, io.SeekStart); err != nil {
-		fmt.Printf("grep internal error: %v", err)
-		return 0
+	buf := make([]byte, boundaryBlock)
+	for pos := offset - 1; pos < fileSize; {
+		size := int64(len(buf))
+		if fileSize-pos < size {
+			size = fileSize - pos
+		}
+		n, err := r.ReadAt(buf[:size], pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		pos += int64(n)
+		if err == io.EOF || n == 0 {
+			// Файл оказался короче fileSize
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
 	}
-	reader := bufio.NewReader(file)
+	return fileSize, nil
+}
 
-	// Читаем до следующей новой строки
-	_, err := reader.ReadBytes('\n')
-	if err == io.EOF {
-		return offset // Достигли конца файла
+// recordEnd - конец первой записи CSV, заканчивающейся не раньше offset: перевод строки
+// вне кавычек. Кавычки считаются с позиции from, которая должна быть началом записи
+// (удвоенная кавычка внутри поля меняет состояние дважды). Файл читается через ReadAt
+func recordEnd(r io.ReaderAt, from, offset, fileSize int64) (int64, error) {
+	if offset >= fileSize {
+		return fileSize, nil
 	}
 
-	// Новая позиция - начало следующей строки
-	newPos, err := file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		fmt.Printf("grep internal error: %v", err)
-		return 0
+	reader := bufio.NewReaderSize(io.NewSectionReader(r, from, fileSize-from), boundaryBlock)
+	inQuotes := false
+	for pos := from; ; pos++ {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			return fileSize, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '\n' && !inQuotes && pos >= offset:
+			return pos + 1, nil
+		}
 	}
-	return newPos
 }
 
-// adjustToLineEnd - находит конец последней полной строки
-func adjustToLineEnd(file *os.File, offset int64, fileSize int64) int64 {
-	if offset >= fileSize {
-		return fileSize
+// LineStartBefore - находит начало строки, содержащей смещение offset,
+// читая файл назад блоками (для обхода файла от конца к началу). Для offset,
+// равного размеру файла, это конец последней полной строки
+func LineStartBefore(file *os.File, offset int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for end := offset; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		block := buf[:end-start]
+		if _, err := file.ReadAt(block, start); err != nil {
+			return 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
+		}
+		if i := bytes.LastIndexByte(block, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
 	}
+	return 0, nil
+}
 
-	// Сохраняем текущую позицию файла
-	originalPos, err := file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		fmt.Printf("grep internal error: %v", err)
-		return 0
+// ReverseChunks - чанки части файла [start, end) от конца к началу. Чанки строятся
+// по одному, чтобы при досрочной остановке (--tail-matches) не размечать весь файл
+type ReverseChunks struct {
+	file        *os.File
+	start       int64
+	end         int64 // конец следующего чанка
+	fileSize    int64
+	chunkSize   int64
+	fingerprint Fingerprint
+}
+
+// NewReverseChunks - создаёт обход части файла [start, end) с конца;
+// start и end должны быть границами строк
+func NewReverseChunks(file *os.File, start, end, fileSize, chunkSize int64) *ReverseChunks {
+	return &ReverseChunks{file: file, start: start, end: end, fileSize: fileSize, chunkSize: chunkSize, fingerprint: fingerprintOf(file)}
+}
+
+// Next - следующий (более ранний) чанк с идентификатором chunkID;
+// false, если область пройдена до начала
+func (r *ReverseChunks) Next(chunkID int) (Chunk, bool, error) {
+	if r.end <= r.start {
+		return Chunk{}, false, nil
 	}
-	defer func() {
-		if _, err := file.Seek(originalPos, io.SeekStart); err != nil {
-			fmt.Printf("grep internal error: %v", err)
-		} // Восстанавливаем позицию
-	}()
-	if _, err = file.Seek(offset, io.SeekStart); err != nil {
-		fmt.Printf("grep internal error: %v", err)
-		return 0
+
+	from := r.end - r.chunkSize
+	if from > r.start {
+		var err error
+		if from, err = LineStartBefore(r.file, from); err != nil {
+			return Chunk{}, false, err
+		}
+	}
+	if from < r.start {
+		from = r.start
 	}
-	reader := bufio.NewReader(file)
 
-	// Ищем конец текущей строки
-	line, err := reader.ReadBytes('\n')
-	if err == io.EOF {
-		return fileSize // Достигли конца файла
+	chunk := Chunk{
+		FilePath:    r.file.Name(),
+		StartOffset: from,
+		EndOffset:   r.end,
+		ChunkID:     chunkID,
+		TotalChunks: 0, // заранее неизвестно
+		FileSize:    r.fileSize,
+		Fingerprint: r.fingerprint,
 	}
+	r.end = from
+	return chunk, true, nil
+}
 
-	// Новая позиция - после символа новой строки
-	newPos := offset + int64(len(line))
-	return newPos
+// Offset - начало последнего выданного чанка (до него файл не просматривался)
+func (r *ReverseChunks) Offset() int64 {
+	return r.end
 }
 
-// GetChunkReader - создает reader для чтения чанка
-func (c *Chunk) GetChunkReader() (io.Reader, error) {
+// Open - открывает файл чанка и сверяет его с отпечатком (Check)
+func (c *Chunk) Open(policy ChangePolicy) (*os.File, bool, error) {
 	file, err := os.Open(c.FilePath)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	changed, err := c.Check(file, policy)
+	if err != nil {
+		file.Close()
+		return nil, false, err
 	}
+	return file, changed, nil
+}
 
-	// Перемещаемся к началу чанка
-	if _, err := file.Seek(c.StartOffset, io.SeekStart); err != nil {
-		fmt.Printf("grep internal error: %v", err)
-		return nil, err
+// Check - сверяет открытый файл чанка с отпечатком, снятым при разметке. Возвращает
+// также, изменился ли файл, если по политике policy его всё же можно читать
+func (c *Chunk) Check(file *os.File, policy ChangePolicy) (bool, error) {
+	if c.Fingerprint.IsZero() {
+		return false, nil
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
 	}
+	return c.Fingerprint.Verify(NewFingerprint(info), policy)
+}
 
-	// Ограничиваем чтение размером чанка
-	return io.LimitReader(file, c.EndOffset-c.StartOffset), nil
+// GetChunkReader - создает reader для чтения чанка из открытого файла (см. Open)
+func (c *Chunk) GetChunkReader(file *os.File) io.Reader {
+	return io.NewSectionReader(file, c.StartOffset, c.EndOffset-c.StartOffset)
+}
+
+// GetOverlapReader - создает reader для чанка вместе с перекрытием margin байт
+// с обеих сторон. Перекрытие слева начинается с начала строки. Возвращает reader
+// и смещение начала самого чанка внутри прочитанных данных
+func (c *Chunk) GetOverlapReader(file *os.File, margin int64) (io.Reader, int64, error) {
+	readStart, readEnd, err := c.OverlapBounds(file, margin)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NewSectionReader(file, readStart, readEnd-readStart), c.StartOffset - readStart, nil
+}
+
+// OverlapBounds - границы чтения чанка с перекрытием margin байт с обеих сторон
+// (см. GetOverlapReader)
+func (c *Chunk) OverlapBounds(r io.ReaderAt, margin int64) (int64, int64, error) {
+	readStart := int64(0)
+	if c.StartOffset > margin {
+		var err error
+		if readStart, err = nextLineStart(r, c.StartOffset-margin, c.FileSize); err != nil {
+			return 0, 0, fmt.Errorf("error reading %s: %v", c.FilePath, err)
+		}
+	}
+	readEnd := c.EndOffset + margin
+	if readEnd > c.FileSize {
+		readEnd = c.FileSize
+	}
+	return readStart, readEnd, nil
 }
 
 // GetChunkSize - возвращает размер чанка в байтах
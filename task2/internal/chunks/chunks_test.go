@@ -0,0 +1,227 @@
+package chunks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tempFile - файл с содержимым data во временном каталоге теста
+func tempFile(t *testing.T, data string) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestNextLineStart(t *testing.T) {
+	data := "ab\ncd\n\nef"
+	// Смещение, стоящее на начале строки, не сдвигается: строка достаётся чанку, который с неё начинается
+	want := []int64{0, 3, 3, 3, 6, 6, 6, 7, 9, 9}
+	for offset, w := range want {
+		got, err := nextLineStart(strings.NewReader(data), int64(offset), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != w {
+			t.Errorf("nextLineStart(%d) = %d, want %d", offset, got, w)
+		}
+	}
+}
+
+func TestSplitRangeBoundaryLine(t *testing.T) {
+	file := tempFile(t, "abc\ndef\nghi\n")
+	got, _, err := SplitBigFile(file, 0, 12, 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Граница каждого чанка приходится ровно на начало строки
+	want := [][2]int64{{0, 4}, {4, 8}, {8, 12}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(got), len(want))
+	}
+	for i, chunk := range got {
+		if chunk.StartOffset != want[i][0] || chunk.EndOffset != want[i][1] {
+			t.Errorf("chunk %d = [%d, %d), want [%d, %d)", i, chunk.StartOffset, chunk.EndOffset, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestSplitRangeCoversEveryLineOnce(t *testing.T) {
+	data := "first\n\nsecond line\nx\nthird line is longer\nlast without newline"
+	file := tempFile(t, data)
+	size := int64(len(data))
+	for chunkSize := int64(1); chunkSize <= size+1; chunkSize++ {
+		got, _, err := SplitBigFile(file, 0, size, chunkSize, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var joined strings.Builder
+		offset := int64(0)
+		for _, chunk := range got {
+			if chunk.StartOffset != offset {
+				t.Fatalf("chunk size %d: chunk starts at %d, previous ended at %d", chunkSize, chunk.StartOffset, offset)
+			}
+			if chunk.StartOffset > 0 && data[chunk.StartOffset-1] != '\n' {
+				t.Fatalf("chunk size %d: chunk starts mid-line at %d", chunkSize, chunk.StartOffset)
+			}
+			joined.WriteString(data[chunk.StartOffset:chunk.EndOffset])
+			offset = chunk.EndOffset
+		}
+		if joined.String() != data {
+			t.Fatalf("chunk size %d: chunks cover %q", chunkSize, joined.String())
+		}
+	}
+}
+
+func TestRecordEnd(t *testing.T) {
+	data := "a,\"x\ny\"\nb,\"\"\"q\n\"\"\"\nc\n"
+	tests := []struct {
+		from, offset int64
+		want         int64
+	}{
+		{0, 0, 8},  // перевод строки внутри кавычек не конец записи
+		{0, 4, 8},  // offset внутри поля в кавычках
+		{0, 8, 19}, // offset на начале записи: она заканчивается дальше
+		// Удвоенные кавычки не закрывают поле
+		{8, 12, 19},
+		{19, 19, 21},
+		{0, 21, 21},
+	}
+	for _, tt := range tests {
+		got, err := recordEnd(strings.NewReader(data), tt.from, tt.offset, int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("recordEnd(%d, %d) = %d, want %d", tt.from, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRangeQuotedKeepsRecords(t *testing.T) {
+	data := "h1,h2\n1,\"multi\nline\nfield\"\n2,\"a \"\"quoted\"\"\nvalue\"\n3,plain\n4,\"\n\n\"\n"
+	// Начала записей: строки, перед которыми перевод строки вне кавычек
+	starts := map[int64]bool{0: true}
+	inQuotes := false
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '"':
+			inQuotes = !inQuotes
+		case data[i] == '\n' && !inQuotes:
+			starts[int64(i+1)] = true
+		}
+	}
+
+	file := tempFile(t, data)
+	size := int64(len(data))
+	for chunkSize := int64(1); chunkSize <= size; chunkSize++ {
+		got, _, err := SplitBigFile(file, 0, size, chunkSize, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset := int64(0)
+		for _, chunk := range got {
+			if chunk.StartOffset != offset || !starts[chunk.StartOffset] {
+				t.Fatalf("chunk size %d: chunk [%d, %d) does not start a record", chunkSize, chunk.StartOffset, chunk.EndOffset)
+			}
+			offset = chunk.EndOffset
+		}
+		if offset != size {
+			t.Fatalf("chunk size %d: chunks end at %d of %d", chunkSize, offset, size)
+		}
+	}
+}
+
+func TestLineStartBefore(t *testing.T) {
+	data := "ab\ncd\n\nef"
+	file := tempFile(t, data)
+	// Для конца файла - конец последней полной строки
+	want := []int64{0, 0, 0, 3, 3, 3, 6, 7, 7, 7}
+	for offset, w := range want {
+		got, err := LineStartBefore(file, int64(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != w {
+			t.Errorf("LineStartBefore(%d) = %d, want %d", offset, got, w)
+		}
+	}
+}
+
+func TestReverseChunks(t *testing.T) {
+	data := "first\nsecond line\n\nthird\na much longer fourth line\nlast\n"
+	file := tempFile(t, data)
+	size := int64(len(data))
+	for chunkSize := int64(1); chunkSize <= size+1; chunkSize++ {
+		// Область начинается со второй строки
+		reverse := NewReverseChunks(file, 6, size, size, chunkSize)
+		end := size
+		for id := 0; ; id++ {
+			chunk, ok, err := reverse.Next(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+			if chunk.ChunkID != id || chunk.EndOffset != end || chunk.StartOffset >= chunk.EndOffset {
+				t.Fatalf("chunk size %d: chunk %d = [%d, %d), previous started at %d", chunkSize, chunk.ChunkID, chunk.StartOffset, chunk.EndOffset, end)
+			}
+			if data[chunk.StartOffset-1] != '\n' {
+				t.Fatalf("chunk size %d: chunk starts mid-line at %d", chunkSize, chunk.StartOffset)
+			}
+			end = chunk.StartOffset
+		}
+		if end != 6 {
+			t.Errorf("chunk size %d: chunks stop at %d, want 6", chunkSize, end)
+		}
+	}
+}
+
+// failingReader - ReaderAt, который отдаёт данные до позиции failAt, а дальше возвращает ошибку
+type failingReader struct {
+	data   string
+	failAt int64
+}
+
+func (r failingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.failAt {
+		return 0, errors.New("device error")
+	}
+	n := copy(p, r.data[off:min(r.failAt, int64(len(r.data)))])
+	if n < len(p) {
+		return n, errors.New("device error")
+	}
+	return n, nil
+}
+
+func TestBoundaryReadErrors(t *testing.T) {
+	data := strings.Repeat("x", 3*boundaryBlock) + "\nnext\n"
+	size := int64(len(data))
+
+	// Строка длиннее блока чтения: граница ищется в следующих блоках
+	if got, err := nextLineStart(strings.NewReader(data), 10, size); err != nil || got != 3*boundaryBlock+1 {
+		t.Errorf("nextLineStart over a long line = %d, %v", got, err)
+	}
+	// Ошибка чтения не выдаётся за конец файла
+	if _, err := nextLineStart(failingReader{data, boundaryBlock}, 10, size); err == nil {
+		t.Error("nextLineStart ignored a read error")
+	}
+	if _, err := recordEnd(failingReader{data, boundaryBlock}, 0, 10, size); err == nil {
+		t.Error("recordEnd ignored a read error")
+	}
+	// Файл короче, чем ожидалось: граница - ожидаемый конец
+	if got, err := nextLineStart(strings.NewReader("abc"), 1, 10); err != nil || got != 10 {
+		t.Errorf("nextLineStart on a shrunk file = %d, %v", got, err)
+	}
+}
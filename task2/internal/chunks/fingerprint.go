@@ -0,0 +1,84 @@
+package chunks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Fingerprint - признаки, по которым видно, что файл изменился после разметки на чанки
+type Fingerprint struct {
+	Size    int64
+	ModTime time.Time
+	Inode   uint64 // 0, если система не сообщает inode
+}
+
+// NewFingerprint - отпечаток файла по результату Stat
+func NewFingerprint(info os.FileInfo) Fingerprint {
+	return Fingerprint{Size: info.Size(), ModTime: info.ModTime(), Inode: inode(info)}
+}
+
+// Equal - совпадают ли отпечатки
+func (f Fingerprint) Equal(other Fingerprint) bool {
+	return f.Size == other.Size && f.ModTime.Equal(other.ModTime) && f.Inode == other.Inode
+}
+
+// IsZero - отпечаток не снят (такой чанк не сверяется с файлом)
+func (f Fingerprint) IsZero() bool {
+	return f.Size == 0 && f.ModTime.IsZero() && f.Inode == 0
+}
+
+// fingerprintOf - отпечаток открытого файла; нулевой, если Stat не удался
+func fingerprintOf(file *os.File) Fingerprint {
+	info, err := file.Stat()
+	if err != nil {
+		return Fingerprint{}
+	}
+	return NewFingerprint(info)
+}
+
+// ChangePolicy - что делать, если файл изменился после разметки на чанки (--on-change)
+type ChangePolicy string
+
+const (
+	OnChangeFail     ChangePolicy = "fail"     // чанк не читается, файл завершается ошибкой
+	OnChangeWarn     ChangePolicy = "warn"     // предупреждение, чанк читается как есть
+	OnChangeSnapshot ChangePolicy = "snapshot" // дописанное после разметки не читается, иные изменения - ошибка
+)
+
+var (
+	// ErrFileChanged - файл изменился после разметки на чанки
+	ErrFileChanged = errors.New("file changed since it was split into chunks")
+	// ErrFileRewritten - файл не только дописан: прежнее содержимое не сохранилось
+	ErrFileRewritten = errors.New("file truncated or rewritten since it was split into chunks")
+)
+
+// ParseChangePolicy - разбирает значение --on-change
+func ParseChangePolicy(value string) (ChangePolicy, error) {
+	switch policy := ChangePolicy(value); policy {
+	case OnChangeFail, OnChangeWarn, OnChangeSnapshot:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid --on-change %q: expected fail, warn or snapshot", value)
+}
+
+// Verify - сверяет отпечаток, снятый при разметке, с текущим. Возвращает true, если
+// файл изменился, но по политике его можно читать (warn), и ошибку, если нельзя.
+// При snapshot чанки кончаются не дальше размера при разметке, поэтому дописанный
+// файл (тот же inode, размер больше) читается так, будто дописанного нет
+func (f Fingerprint) Verify(current Fingerprint, policy ChangePolicy) (bool, error) {
+	if f.IsZero() || f.Equal(current) {
+		return false, nil
+	}
+	switch policy {
+	case OnChangeWarn:
+		return true, nil
+	case OnChangeSnapshot:
+		if current.Inode == f.Inode && current.Size > f.Size {
+			return false, nil
+		}
+		return false, ErrFileRewritten
+	}
+	return false, ErrFileChanged
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package chunks
+
+import "os"
+
+// inode - на этой системе inode недоступен, файл сравнивается по размеру и времени изменения
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,58 @@
+package chunks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFingerprintVerify(t *testing.T) {
+	planned := Fingerprint{Size: 100, ModTime: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Inode: 7}
+	appended := Fingerprint{Size: 150, ModTime: planned.ModTime.Add(time.Second), Inode: 7}
+	truncated := Fingerprint{Size: 50, ModTime: appended.ModTime, Inode: 7}
+	touched := Fingerprint{Size: 100, ModTime: appended.ModTime, Inode: 7}
+	replaced := Fingerprint{Size: 150, ModTime: appended.ModTime, Inode: 8}
+
+	tests := []struct {
+		name    string
+		current Fingerprint
+		policy  ChangePolicy
+		changed bool
+		err     error
+	}{
+		{"unchanged", planned, OnChangeFail, false, nil},
+		{"appended, fail", appended, OnChangeFail, false, ErrFileChanged},
+		{"touched, fail", touched, OnChangeFail, false, ErrFileChanged},
+		{"appended, warn", appended, OnChangeWarn, true, nil},
+		{"replaced, warn", replaced, OnChangeWarn, true, nil},
+		// snapshot: дописанный файл читается в прежних границах, остальное - ошибка
+		{"appended, snapshot", appended, OnChangeSnapshot, false, nil},
+		{"truncated, snapshot", truncated, OnChangeSnapshot, false, ErrFileRewritten},
+		{"touched, snapshot", touched, OnChangeSnapshot, false, ErrFileRewritten},
+		{"replaced, snapshot", replaced, OnChangeSnapshot, false, ErrFileRewritten},
+	}
+	for _, tt := range tests {
+		changed, err := planned.Verify(tt.current, tt.policy)
+		if changed != tt.changed || !errors.Is(err, tt.err) {
+			t.Errorf("%s: Verify = %v, %v; want %v, %v", tt.name, changed, err, tt.changed, tt.err)
+		}
+	}
+
+	// Чанк без отпечатка (например, стандартный ввод) не сверяется
+	if changed, err := (Fingerprint{}).Verify(appended, OnChangeFail); changed || err != nil {
+		t.Errorf("zero fingerprint: %v, %v", changed, err)
+	}
+}
+
+func TestParseChangePolicy(t *testing.T) {
+	for _, value := range []string{"fail", "warn", "snapshot"} {
+		if policy, err := ParseChangePolicy(value); err != nil || string(policy) != value {
+			t.Errorf("ParseChangePolicy(%q) = %q, %v", value, policy, err)
+		}
+	}
+	for _, value := range []string{"", "ignore", "FAIL"} {
+		if _, err := ParseChangePolicy(value); err == nil {
+			t.Errorf("ParseChangePolicy(%q) accepted", value)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package chunks
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode - номер inode файла
+func inode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+package chunks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ManifestVersion - версия формата плана; увеличивается при несовместимых изменениях
+const ManifestVersion = 2
+
+// Manifest - план поиска: файлы с отпечатками и их чанки. Сохраняется командой
+// plan и читается --plan-in, поэтому формат в JSON не зависит от полей Chunk
+type Manifest struct {
+	ChunkSize int64
+	Files     []PlannedFile
+	Chunks    []Chunk
+}
+
+// PlannedFile - файл плана и его отпечаток на момент разметки
+type PlannedFile struct {
+	Path        string
+	Fingerprint Fingerprint
+}
+
+type manifestWire struct {
+	Version   int         `json:"version"`
+	ChunkSize int64       `json:"chunk_size"`
+	Files     []fileWire  `json:"files"`
+	Chunks    []chunkWire `json:"chunks"`
+}
+
+type fileWire struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Inode   uint64    `json:"inode,omitempty"`
+}
+
+type chunkWire struct {
+	ID        int    `json:"id"`
+	File      int    `json:"file"` // номер файла в files: один путь может встречаться дважды
+	Path      string `json:"path"`
+	Start     int64  `json:"start"`
+	End       int64  `json:"end"`
+	Size      int64  `json:"size"`
+	FirstLine int    `json:"first_line"` // номер первой строки чанка в файле, с 1
+	Total     int    `json:"total"`      // чанков в файле
+	FileSize  int64  `json:"file_size"`
+}
+
+// WriteManifest - выводит план в JSON
+func WriteManifest(w io.Writer, m Manifest) error {
+	wire := manifestWire{Version: ManifestVersion, ChunkSize: m.ChunkSize, Files: []fileWire{}, Chunks: []chunkWire{}}
+	for _, f := range m.Files {
+		wire.Files = append(wire.Files, fileWire{
+			Path:    f.Path,
+			Size:    f.Fingerprint.Size,
+			ModTime: f.Fingerprint.ModTime,
+			Inode:   f.Fingerprint.Inode,
+		})
+	}
+	for _, c := range m.Chunks {
+		wire.Chunks = append(wire.Chunks, chunkWire{
+			ID:        c.ChunkID,
+			File:      c.FileIndex,
+			Path:      c.FilePath,
+			Start:     c.StartOffset,
+			End:       c.EndOffset,
+			Size:      c.GetChunkSize(),
+			FirstLine: c.LinesBefore + 1,
+			Total:     c.TotalChunks,
+			FileSize:  c.FileSize,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(wire)
+}
+
+// ReadManifest - читает план, сохранённый WriteManifest
+func ReadManifest(r io.Reader) (Manifest, error) {
+	var wire manifestWire
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&wire); err != nil {
+		return Manifest{}, fmt.Errorf("invalid plan: %v", err)
+	}
+	if wire.Version != ManifestVersion {
+		return Manifest{}, fmt.Errorf("unsupported plan version %d, expected %d", wire.Version, ManifestVersion)
+	}
+
+	m := Manifest{ChunkSize: wire.ChunkSize}
+	for _, f := range wire.Files {
+		fingerprint := Fingerprint{Size: f.Size, ModTime: f.ModTime, Inode: f.Inode}
+		m.Files = append(m.Files, PlannedFile{Path: f.Path, Fingerprint: fingerprint})
+	}
+	for _, c := range wire.Chunks {
+		if c.File < 0 || c.File >= len(m.Files) || m.Files[c.File].Path != c.Path {
+			return Manifest{}, fmt.Errorf("invalid plan: chunk %d refers to unlisted file %s", c.ID, c.Path)
+		}
+		if c.Start < 0 || c.End < c.Start || c.End > c.FileSize || c.FirstLine < 1 {
+			return Manifest{}, fmt.Errorf("invalid plan: chunk %d has invalid bounds", c.ID)
+		}
+		if c.Size != c.End-c.Start || c.FileSize != m.Files[c.File].Fingerprint.Size {
+			return Manifest{}, fmt.Errorf("invalid plan: chunk %d has inconsistent size", c.ID)
+		}
+		m.Chunks = append(m.Chunks, Chunk{
+			FilePath:    c.Path,
+			FileIndex:   c.File,
+			StartOffset: c.Start,
+			EndOffset:   c.End,
+			ChunkID:     c.ID,
+			TotalChunks: c.Total,
+			FileSize:    c.FileSize,
+			LinesBefore: c.FirstLine - 1,
+			Fingerprint: m.Files[c.File].Fingerprint,
+		})
+	}
+	return m, nil
+}
+
+// NumberChunks - проставляет чанкам одного файла число строк файла до каждого из них
+// (для номеров первых строк в плане). Чанки должны идти по порядку
+func NumberChunks(file *os.File, fileChunks []Chunk) error {
+	if len(fileChunks) == 0 {
+		return nil
+	}
+	lines, err := CountLines(file, fileChunks[0].StartOffset)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 1024*1024)
+	for i := range fileChunks {
+		fileChunks[i].LinesBefore = lines
+		end := fileChunks[i].EndOffset
+		for offset := fileChunks[i].StartOffset; offset < end; {
+			size := int64(len(buf))
+			if end-offset < size {
+				size = end - offset
+			}
+			n, err := file.ReadAt(buf[:size], offset)
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			offset += int64(n)
+			if err != nil && !(err == io.EOF && offset >= end) {
+				return fmt.Errorf("error reading %s: %v", file.Name(), err)
+			}
+		}
+	}
+	return nil
+}
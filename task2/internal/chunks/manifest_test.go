@@ -0,0 +1,117 @@
+package chunks
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleManifest - план из двух файлов: первый размечен на два чанка
+func sampleManifest() Manifest {
+	a := Fingerprint{Size: 30, ModTime: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Inode: 77}
+	b := Fingerprint{Size: 5, ModTime: time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)}
+	return Manifest{
+		ChunkSize: 16,
+		Files:     []PlannedFile{{Path: "a.log", Fingerprint: a}, {Path: "b.log", Fingerprint: b}},
+		Chunks: []Chunk{
+			{FilePath: "a.log", FileIndex: 0, StartOffset: 0, EndOffset: 18, ChunkID: 0, TotalChunks: 2, FileSize: 30, Fingerprint: a},
+			{FilePath: "a.log", FileIndex: 0, StartOffset: 18, EndOffset: 30, ChunkID: 1, TotalChunks: 2, FileSize: 30, LinesBefore: 3, Fingerprint: a},
+			{FilePath: "b.log", FileIndex: 1, StartOffset: 0, EndOffset: 5, ChunkID: 2, TotalChunks: 1, FileSize: 5, Fingerprint: b},
+		},
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	want := sampleManifest()
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	// Номер первой строки в плане - с 1
+	if !strings.Contains(buf.String(), `"first_line": 4`) || !strings.Contains(buf.String(), `"version": 2`) {
+		t.Errorf("plan JSON:\n%s", buf.String())
+	}
+
+	got, err := ReadManifest(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ChunkSize != want.ChunkSize || len(got.Files) != len(want.Files) || len(got.Chunks) != len(want.Chunks) {
+		t.Fatalf("read %+v", got)
+	}
+	for i, f := range got.Files {
+		if f.Path != want.Files[i].Path || !f.Fingerprint.ModTime.Equal(want.Files[i].Fingerprint.ModTime) ||
+			f.Fingerprint.Size != want.Files[i].Fingerprint.Size || f.Fingerprint.Inode != want.Files[i].Fingerprint.Inode {
+			t.Errorf("file %d = %+v, want %+v", i, f, want.Files[i])
+		}
+	}
+	for i, c := range got.Chunks {
+		w := want.Chunks[i]
+		if c.FilePath != w.FilePath || c.FileIndex != w.FileIndex || c.StartOffset != w.StartOffset || c.EndOffset != w.EndOffset ||
+			c.ChunkID != w.ChunkID || c.TotalChunks != w.TotalChunks || c.FileSize != w.FileSize || c.LinesBefore != w.LinesBefore ||
+			c.Fingerprint.Size != w.Fingerprint.Size {
+			t.Errorf("chunk %d = %+v, want %+v", i, c, w)
+		}
+	}
+}
+
+func TestReadManifestRejects(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, sampleManifest()); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.String()
+
+	// edit - план с изменённым первым чанком или самим планом
+	edit := func(change func(plan map[string]any, chunk map[string]any)) string {
+		var plan map[string]any
+		if err := json.Unmarshal([]byte(valid), &plan); err != nil {
+			t.Fatal(err)
+		}
+		change(plan, plan["chunks"].([]any)[0].(map[string]any))
+		data, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	tests := []struct {
+		name string
+		plan string
+	}{
+		{"not JSON", "{"},
+		{"old version", edit(func(plan, _ map[string]any) { plan["version"] = 1 })},
+		{"unknown field", edit(func(plan, _ map[string]any) { plan["extra"] = true })},
+		{"unlisted file", edit(func(_, chunk map[string]any) { chunk["file"] = 5 })},
+		{"path of another file", edit(func(_, chunk map[string]any) { chunk["path"] = "b.log" })},
+		{"end before start", edit(func(_, chunk map[string]any) { chunk["start"] = 20 })},
+		{"end past the file", edit(func(_, chunk map[string]any) { chunk["end"] = 31 })},
+		{"zero first line", edit(func(_, chunk map[string]any) { chunk["first_line"] = 0 })},
+		{"size disagrees with bounds", edit(func(_, chunk map[string]any) { chunk["size"] = 17 })},
+		{"file size disagrees with file", edit(func(_, chunk map[string]any) { chunk["file_size"] = 40; chunk["end"] = 18 })},
+	}
+	for _, tt := range tests {
+		if _, err := ReadManifest(strings.NewReader(tt.plan)); err == nil {
+			t.Errorf("%s: plan accepted", tt.name)
+		}
+	}
+}
+
+func TestNumberChunks(t *testing.T) {
+	data := "a\nb\nc\n\nlong line\nlast"
+	file := tempFile(t, data)
+	fileChunks, _, err := SplitBigFile(file, 0, int64(len(data)), 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NumberChunks(file, fileChunks); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range fileChunks {
+		if want := strings.Count(data[:chunk.StartOffset], "\n"); chunk.LinesBefore != want {
+			t.Errorf("chunk at %d: %d lines before, want %d", chunk.StartOffset, chunk.LinesBefore, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package chunks
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrNotMappable - файл нельзя отобразить в память (канал, специальный файл, система
+// без mmap): чанк читается обычным образом через Open
+var ErrNotMappable = errors.New("file cannot be memory-mapped")
+
+// Mappings - файлы, отображённые в память (--mmap), общие для воркеров: файл
+// отображается один раз, и каждый чанк получает срез отображения. Отображения,
+// с которыми сейчас никто не работает, хранятся не больше maxIdle штук, чтобы
+// при множестве файлов не упереться в ограничение числа отображений процесса
+type Mappings struct {
+	mu      sync.Mutex
+	files   map[string]*mapping
+	idle    []*mapping // отображения без пользователей, от давних к недавним
+	maxIdle int
+}
+
+// mapping - отображение одного файла
+type mapping struct {
+	path        string
+	data        []byte
+	fingerprint Fingerprint // файл в момент отображения
+	refs        int         // сколько чанков сейчас читают отображение
+}
+
+// NewMappings - создаёт пустой набор отображений
+func NewMappings(maxIdle int) *Mappings {
+	return &Mappings{files: make(map[string]*mapping), maxIdle: max(1, maxIdle)}
+}
+
+// Acquire - отображение файла чанка. Файл сверяется с отпечатком чанка по политике
+// policy, как в Open; changed - файл изменился, но его можно читать. Данные действительны
+// до вызова release: строки, которые нужны дольше, надо скопировать. ErrNotMappable -
+// чанк нужно прочитать обычным образом
+func (m *Mappings) Acquire(c Chunk, policy ChangePolicy) (data []byte, changed bool, release func(), err error) {
+	info, err := os.Stat(c.FilePath)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, false, nil, ErrNotMappable
+	}
+	current := NewFingerprint(info)
+	if changed, err = c.Fingerprint.Verify(current, policy); err != nil {
+		return nil, false, nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mp := m.files[c.FilePath]
+	if mp != nil && (mp.fingerprint.Inode != current.Inode || int64(len(mp.data)) < min(c.EndOffset, current.Size)) {
+		// Файл подменён или дописан после отображения: отображаем заново, старое
+		// снимается, когда его отпустят все читающие
+		m.forget(mp)
+		mp = nil
+	}
+	if mp == nil {
+		if mp, changed, err = m.mapChunk(c, policy); err != nil {
+			return nil, false, nil, err
+		}
+		m.files[c.FilePath] = mp
+	} else if mp.refs == 0 {
+		m.removeIdle(mp)
+	}
+	mp.refs++
+	return mp.data, changed, func() { m.release(mp) }, nil
+}
+
+// mapChunk - открывает файл чанка (со сверкой отпечатка) и отображает его целиком
+func (m *Mappings) mapChunk(c Chunk, policy ChangePolicy) (*mapping, bool, error) {
+	file, changed, err := c.Open(policy)
+	if err != nil {
+		return nil, false, err
+	}
+	// Отображение не зависит от дескриптора, файл сразу закрывается
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	mp := &mapping{path: c.FilePath, fingerprint: NewFingerprint(info)}
+	if info.Size() > 0 {
+		if mp.data, err = mapFile(file, info.Size()); err != nil {
+			return nil, false, err
+		}
+	}
+	return mp, changed, nil
+}
+
+// release - чанк закончил работу с отображением
+func (m *Mappings) release(mp *mapping) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mp.refs--
+	if mp.refs > 0 {
+		return
+	}
+	if m.files[mp.path] != mp {
+		// Отображение заменено новым, пока его читали
+		unmapFile(mp.data)
+		return
+	}
+	m.idle = append(m.idle, mp)
+	if len(m.idle) > m.maxIdle {
+		oldest := m.idle[0]
+		m.idle = m.idle[1:]
+		delete(m.files, oldest.path)
+		unmapFile(oldest.data)
+	}
+}
+
+// forget - убирает отображение из набора; без пользователей оно снимается сразу
+func (m *Mappings) forget(mp *mapping) {
+	delete(m.files, mp.path)
+	if mp.refs == 0 {
+		m.removeIdle(mp)
+		unmapFile(mp.data)
+	}
+}
+
+// removeIdle - убирает отображение из списка неиспользуемых
+func (m *Mappings) removeIdle(mp *mapping) {
+	for i, idle := range m.idle {
+		if idle == mp {
+			m.idle = append(m.idle[:i], m.idle[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close - снимает все отображения; вызывается, когда чанки больше не читаются
+func (m *Mappings) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var firstErr error
+	for path, mp := range m.files {
+		if err := unmapFile(mp.data); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(m.files, path)
+	}
+	m.idle = nil
+	return firstErr
+}
@@ -0,0 +1,154 @@
+//go:build unix
+
+package chunks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// plannedChunk - чанк [start, end) файла path с отпечатком файла в момент вызова;
+// end < 0 - до конца файла
+func plannedChunk(t *testing.T, path string, start, end int64) Chunk {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end < 0 {
+		end = info.Size()
+	}
+	return Chunk{FilePath: path, StartOffset: start, EndOffset: end, FileSize: info.Size(), Fingerprint: NewFingerprint(info)}
+}
+
+// acquire - отображение файла чанка c при политике fail
+func acquire(t *testing.T, m *Mappings, c Chunk) ([]byte, func()) {
+	t.Helper()
+	data, changed, release, err := m.Acquire(c, OnChangeFail)
+	if err != nil || changed {
+		t.Fatalf("Acquire(%s [%d, %d)) = %v, %v", c.FilePath, c.StartOffset, c.EndOffset, changed, err)
+	}
+	return data, release
+}
+
+func TestMappingsShareFile(t *testing.T) {
+	path := tempFile(t, "first line\nsecond line\n").Name()
+	m := NewMappings(2)
+	defer m.Close()
+
+	// Чанки одного файла получают одно отображение всего файла
+	first, releaseFirst := acquire(t, m, plannedChunk(t, path, 0, 11))
+	second, releaseSecond := acquire(t, m, plannedChunk(t, path, 11, -1))
+	if string(first) != "first line\nsecond line\n" || &first[0] != &second[0] {
+		t.Fatalf("chunks got %q and %q from different mappings", first, second)
+	}
+	releaseFirst()
+	if len(m.idle) != 0 {
+		t.Errorf("mapping is idle while a chunk still reads it")
+	}
+	releaseSecond()
+	if len(m.files) != 1 || len(m.idle) != 1 {
+		t.Errorf("released mapping: %d files, %d idle; want 1, 1", len(m.files), len(m.idle))
+	}
+
+	// Неиспользуемое отображение берётся снова
+	again, release := acquire(t, m, plannedChunk(t, path, 0, -1))
+	if &again[0] != &first[0] || len(m.idle) != 0 {
+		t.Errorf("idle mapping was not reused")
+	}
+	release()
+}
+
+func TestMappingsRemapAppended(t *testing.T) {
+	path := tempFile(t, "old\n").Name()
+	m := NewMappings(2)
+	defer m.Close()
+
+	old, releaseOld := acquire(t, m, plannedChunk(t, path, 0, -1))
+	if err := os.WriteFile(path, []byte("old\nappended\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Чанк нового плана заходит за конец отображения: файл отображается заново,
+	// а прежнее отображение остаётся доступным, пока его не отпустят
+	current, release := acquire(t, m, plannedChunk(t, path, 4, -1))
+	if string(current) != "old\nappended\n" {
+		t.Errorf("remapped data = %q", current)
+	}
+	if string(old) != "old\n" {
+		t.Errorf("previous mapping changed to %q", old)
+	}
+	releaseOld()
+	release()
+	if len(m.files) != 1 || len(m.idle) != 1 || len(m.idle[0].data) != len(current) {
+		t.Errorf("after remap: %d files, %d idle", len(m.files), len(m.idle))
+	}
+}
+
+func TestMappingsIdleLimit(t *testing.T) {
+	dir := t.TempDir()
+	m := NewMappings(1)
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		data, release := acquire(t, m, plannedChunk(t, path, 0, -1))
+		if string(data) != name+"\n" {
+			t.Errorf("%s: data = %q", name, data)
+		}
+		release()
+	}
+	// Хранится только последнее неиспользуемое отображение
+	if len(m.files) != 1 || len(m.idle) != 1 || m.idle[0].path != filepath.Join(dir, "c") {
+		t.Errorf("idle mappings: %d files, %d idle", len(m.files), len(m.idle))
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.files) != 0 || len(m.idle) != 0 {
+		t.Errorf("Close left %d files, %d idle", len(m.files), len(m.idle))
+	}
+}
+
+func TestMappingsFallbackAndChanges(t *testing.T) {
+	m := NewMappings(1)
+	defer m.Close()
+
+	// Каталог, канал или устройство читаются обычным образом
+	dir := t.TempDir()
+	if _, _, _, err := m.Acquire(Chunk{FilePath: dir}, OnChangeFail); !errors.Is(err, ErrNotMappable) {
+		t.Errorf("directory: err = %v, want ErrNotMappable", err)
+	}
+
+	// Пустой файл не отображается, но читается как пустой
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, release := acquire(t, m, plannedChunk(t, empty, 0, -1))
+	if len(data) != 0 {
+		t.Errorf("empty file: data = %q", data)
+	}
+	release()
+
+	// Файл сверяется с отпечатком чанка, как при обычном чтении
+	path := filepath.Join(dir, "log")
+	if err := os.WriteFile(path, []byte("planned\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := plannedChunk(t, path, 0, -1)
+	if err := os.WriteFile(path, []byte("planned\nappended\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := m.Acquire(c, OnChangeFail); !errors.Is(err, ErrFileChanged) {
+		t.Errorf("fail: err = %v, want ErrFileChanged", err)
+	}
+	data, changed, release, err := m.Acquire(c, OnChangeWarn)
+	if err != nil || !changed || string(data) != "planned\nappended\n" {
+		t.Errorf("warn: %q, %v, %v", data, changed, err)
+	} else {
+		release()
+	}
+}
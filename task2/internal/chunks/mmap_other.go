@@ -0,0 +1,15 @@
+//go:build !unix
+
+package chunks
+
+import "os"
+
+// mapFile - на этой системе отображение в память не поддерживается, файлы читаются обычным образом
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, ErrNotMappable
+}
+
+// unmapFile - снимать нечего
+func unmapFile(data []byte) error {
+	return nil
+}
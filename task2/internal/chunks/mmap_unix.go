@@ -0,0 +1,31 @@
+//go:build unix
+
+package chunks
+
+import (
+	"math"
+	"os"
+	"syscall"
+)
+
+// mapFile - отображает первые size байт файла в память только для чтения
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	if size > math.MaxInt {
+		return nil, ErrNotMappable
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		// Например, файловая система не поддерживает mmap: файл читается обычным образом
+		return nil, ErrNotMappable
+	}
+	return data, nil
+}
+
+// unmapFile - снимает отображение
+func unmapFile(data []byte) error {
+	if len(data) == 0 {
+		// Пустые файлы не отображаются
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,124 @@
+package chunks
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MinChunkSize - нижняя граница размера чанка при автоматическом выборе:
+	// меньшие чанки не окупают накладные расходы на задачу
+	MinChunkSize = 256 * 1024 // 256KB
+	// chunksPerWorker - сколько чанков в среднем приходится на воркера при автоматическом
+	// выборе размера: с запасом, чтобы освободившиеся воркеры забирали оставшиеся чанки
+	chunksPerWorker = 4
+	// maxBatchChunks - сколько чанков маленьких файлов самое большее объединяется в одну задачу
+	maxBatchChunks = 256
+)
+
+// Planner - выбирает размер чанков: заданный --chunk-size либо подобранный по общему
+// объёму ввода и числу воркеров в пределах [MinChunkSize, MaxChunkSize]
+type Planner struct {
+	chunkSize int64 // --chunk-size; 0 - подбирается автоматически
+	workers   int
+}
+
+// NewPlanner - разбирает --chunk-size (пустая строка - автоматический выбор)
+func NewPlanner(chunkSize string, workers int) (*Planner, error) {
+	p := &Planner{workers: workers}
+	if p.workers < 1 {
+		p.workers = 1
+	}
+	if chunkSize != "" {
+		size, err := ParseSize(chunkSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --chunk-size: %v", err)
+		}
+		if size == 0 {
+			return nil, fmt.Errorf("--chunk-size must be positive")
+		}
+		p.chunkSize = size
+	}
+	return p, nil
+}
+
+// ChunkSize - размер чанка для ввода общим объёмом totalSize байт
+func (p *Planner) ChunkSize(totalSize int64) int64 {
+	if p.chunkSize > 0 {
+		return p.chunkSize
+	}
+	size := totalSize / int64(p.workers*chunksPerWorker)
+	if size < MinChunkSize {
+		return MinChunkSize
+	}
+	if size > MaxChunkSize {
+		return MaxChunkSize
+	}
+	return size
+}
+
+// Batcher - собирает чанки маленьких файлов в общие задачи размером около чанка,
+// чтобы сотни мелких файлов не превращались в сотни задач
+type Batcher struct {
+	limit  int64
+	chunks []Chunk
+	size   int64
+}
+
+// NewBatcher - создаёт Batcher для чанков размера chunkSize
+func NewBatcher(chunkSize int64) *Batcher {
+	return &Batcher{limit: chunkSize}
+}
+
+// Add - добавляет чанк. Возвращает чанки готовой задачи либо nil, если чанк
+// отложен до заполнения пакета. Чанк размером от половины limit идёт отдельной задачей
+func (b *Batcher) Add(chunk Chunk) []Chunk {
+	size := chunk.GetChunkSize()
+	if size >= b.limit/2 {
+		return []Chunk{chunk}
+	}
+	b.chunks = append(b.chunks, chunk)
+	b.size += size
+	if b.size >= b.limit || len(b.chunks) >= maxBatchChunks {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Flush - отложенные чанки одной задачей (nil, если их нет)
+func (b *Batcher) Flush() []Chunk {
+	batch := b.chunks
+	b.chunks, b.size = nil, 0
+	return batch
+}
+
+// ParseSize - размер в байтах с необязательным суффиксом K, M, G, T (степени 1024)
+func ParseSize(value string) (int64, error) {
+	multiplier, digits := int64(1), value
+	if n := len(value); n > 0 {
+		switch strings.ToUpper(value[n-1:]) {
+		case "K":
+			multiplier = 1 << 10
+		case "M":
+			multiplier = 1 << 20
+		case "G":
+			multiplier = 1 << 30
+		case "T":
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			digits = value[:n-1]
+		}
+	}
+
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	if size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return size * multiplier, nil
+}
@@ -0,0 +1,116 @@
+package chunks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"4K", 4 << 10},
+		{"4k", 4 << 10},
+		{"10M", 10 << 20},
+		{"2G", 2 << 30},
+		{"1T", 1 << 40},
+		{"8388607T", 8388607 << 40},
+		{"9223372036854775807", 1<<63 - 1},
+	}
+	for _, tt := range tests {
+		if got, err := ParseSize(tt.value); err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"", "K", "-1", "1.5M", "10X", "1 K", "9223372036854775808"} {
+		if _, err := ParseSize(value); err == nil {
+			t.Errorf("ParseSize(%q) accepted", value)
+		}
+	}
+	// Переполнение int64 при умножении на суффикс
+	for _, value := range []string{"8388608T", "9007199254740992K", "99999999999G"} {
+		if _, err := ParseSize(value); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("ParseSize(%q) error = %v, want too large", value, err)
+		}
+	}
+}
+
+func TestPlannerChunkSize(t *testing.T) {
+	fixed, err := NewPlanner("1K", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fixed.ChunkSize(1 << 40); got != 1024 {
+		t.Errorf("--chunk-size 1K: chunk size %d", got)
+	}
+
+	auto, err := NewPlanner("", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		total int64
+		want  int64
+	}{
+		{0, MinChunkSize},
+		{1 << 20, MinChunkSize},
+		// По chunksPerWorker чанков на воркера
+		{64 << 20, 4 << 20},
+		{1 << 40, MaxChunkSize},
+	}
+	for _, tt := range tests {
+		if got := auto.ChunkSize(tt.total); got != tt.want {
+			t.Errorf("ChunkSize(%d) = %d, want %d", tt.total, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"0", "abc", "100000000000T"} {
+		if _, err := NewPlanner(value, 1); err == nil {
+			t.Errorf("NewPlanner(%q) accepted", value)
+		}
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	chunk := func(id int, size int64) Chunk { return Chunk{ChunkID: id, EndOffset: size} }
+	b := NewBatcher(100)
+
+	// Большой чанк идёт отдельной задачей, маленькие копятся до размера чанка
+	if batch := b.Add(chunk(0, 50)); len(batch) != 1 || batch[0].ChunkID != 0 {
+		t.Errorf("big chunk batch = %+v", batch)
+	}
+	for id := 1; id <= 3; id++ {
+		if batch := b.Add(chunk(id, 30)); batch != nil {
+			t.Errorf("chunk %d flushed early: %+v", id, batch)
+		}
+	}
+	batch := b.Add(chunk(4, 10))
+	if len(batch) != 4 || batch[0].ChunkID != 1 || batch[3].ChunkID != 4 {
+		t.Errorf("full batch = %+v", batch)
+	}
+	if batch := b.Flush(); batch != nil {
+		t.Errorf("empty flush = %+v", batch)
+	}
+	b.Add(chunk(5, 1))
+	if batch := b.Flush(); len(batch) != 1 || batch[0].ChunkID != 5 {
+		t.Errorf("flush = %+v", batch)
+	}
+
+	// Не больше maxBatchChunks чанков в задаче
+	b = NewBatcher(1 << 30)
+	flushed := 0
+	for id := 0; id < maxBatchChunks*2; id++ {
+		if batch := b.Add(chunk(id, 1)); batch != nil {
+			flushed++
+			if len(batch) != maxBatchChunks {
+				t.Errorf("batch of %d chunks", len(batch))
+			}
+		}
+	}
+	if flushed != 2 {
+		t.Errorf("flushed %d batches, want 2", flushed)
+	}
+}
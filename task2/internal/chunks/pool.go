@@ -0,0 +1,145 @@
+package chunks
+
+import (
+	"os"
+	"sync"
+)
+
+// FilePool - открытые файлы, общие для разметки и воркеров. Файл открывается, только
+// когда он нужен чанку, все чанки одного файла читают его через один дескриптор (ReadAt),
+// и одновременно открыто не больше limit файлов: неиспользуемые дескрипторы закрываются,
+// когда место нужно другому файлу, а если все заняты, Open ждёт освобождения
+type FilePool struct {
+	mu     sync.Mutex
+	freed  *sync.Cond
+	files  map[string]*pooledFile
+	idle   []*pooledFile // открытые файлы без пользователей, от давних к недавним
+	open   int           // открытые и открываемые сейчас файлы
+	limit  int
+	closed bool
+}
+
+// pooledFile - открытый файл пула
+type pooledFile struct {
+	path string
+	file *os.File
+	refs int // сколько пользователей сейчас читают файл
+}
+
+// NewFilePool - создаёт пул, в котором открыто не больше limit файлов
+func NewFilePool(limit int) *FilePool {
+	p := &FilePool{files: make(map[string]*pooledFile), limit: max(1, limit)}
+	p.freed = sync.NewCond(&p.mu)
+	return p
+}
+
+// Open - открытый файл по пути и функция, возвращающая его в пул. Файл общий:
+// закрывать его и менять позицию (Read, Seek) нельзя, только ReadAt
+func (p *FilePool) Open(path string) (*os.File, func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if pf := p.files[path]; pf != nil {
+			return p.use(pf)
+		}
+		if p.open < p.limit {
+			break
+		}
+		if len(p.idle) > 0 {
+			p.closeFile(p.idle[0])
+			continue
+		}
+		p.freed.Wait()
+	}
+
+	// Место занято заранее, файл открывается без блокировки пула
+	p.open++
+	p.mu.Unlock()
+	file, err := os.Open(path)
+	p.mu.Lock()
+	if err != nil {
+		p.open--
+		p.freed.Broadcast()
+		return nil, nil, err
+	}
+	if pf := p.files[path]; pf != nil {
+		// Тот же файл успели открыть параллельно
+		file.Close()
+		p.open--
+		p.freed.Broadcast()
+		return p.use(pf)
+	}
+	pf := &pooledFile{path: path, file: file}
+	p.files[path] = pf
+	return p.use(pf)
+}
+
+// use - выдаёт открытый файл ещё одному пользователю
+func (p *FilePool) use(pf *pooledFile) (*os.File, func(), error) {
+	if pf.refs == 0 {
+		p.removeIdle(pf)
+	}
+	pf.refs++
+	var once sync.Once
+	return pf.file, func() { once.Do(func() { p.release(pf) }) }, nil
+}
+
+// release - пользователь закончил работу с файлом
+func (p *FilePool) release(pf *pooledFile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pf.refs--
+	if pf.refs > 0 {
+		return
+	}
+	if p.closed {
+		// Пул закрыт, пока файл читали
+		p.closeFile(pf)
+		return
+	}
+	p.idle = append(p.idle, pf)
+	p.freed.Broadcast()
+}
+
+// closeFile - закрывает файл без пользователей
+func (p *FilePool) closeFile(pf *pooledFile) {
+	p.removeIdle(pf)
+	delete(p.files, pf.path)
+	pf.file.Close()
+	p.open--
+	p.freed.Broadcast()
+}
+
+// removeIdle - убирает файл из списка неиспользуемых
+func (p *FilePool) removeIdle(pf *pooledFile) {
+	for i, idle := range p.idle {
+		if idle == pf {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return
+		}
+	}
+}
+
+// CloseIdle - закрывает неиспользуемые файлы; пул продолжает работать, и файл,
+// понадобившийся снова, открывается заново
+func (p *FilePool) CloseIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeIdle()
+}
+
+// Close - закрывает неиспользуемые файлы; файлы, которые ещё читают, закрываются,
+// когда их вернут в пул
+func (p *FilePool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.closeIdle()
+}
+
+// closeIdle - закрывает файлы без пользователей
+func (p *FilePool) closeIdle() {
+	for len(p.idle) > 0 {
+		p.closeFile(p.idle[0])
+	}
+}
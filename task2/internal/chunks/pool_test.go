@@ -0,0 +1,154 @@
+package chunks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// poolFiles - файлы с именами names в общем временном каталоге
+func poolFiles(t *testing.T, names ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[i], []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// openPooled - файл пула по пути path
+func openPooled(t *testing.T, p *FilePool, path string) (*os.File, func()) {
+	t.Helper()
+	file, release, err := p.Open(path)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", path, err)
+	}
+	return file, release
+}
+
+// isClosed - дескриптор файла закрыт
+func isClosed(file *os.File) bool {
+	_, err := file.ReadAt(make([]byte, 1), 0)
+	return errors.Is(err, os.ErrClosed)
+}
+
+func TestFilePoolSharesFile(t *testing.T) {
+	paths := poolFiles(t, "a")
+	p := NewFilePool(4)
+	defer p.Close()
+
+	// Чанки одного файла читают его через один дескриптор
+	first, releaseFirst := openPooled(t, p, paths[0])
+	second, releaseSecond := openPooled(t, p, paths[0])
+	if first != second || p.open != 1 {
+		t.Fatalf("same path opened twice: %d open", p.open)
+	}
+	releaseFirst()
+	releaseFirst() // повторный возврат ничего не меняет
+	if len(p.idle) != 0 {
+		t.Errorf("file is idle while still in use")
+	}
+	releaseSecond()
+	if len(p.idle) != 1 || isClosed(first) {
+		t.Errorf("released file: %d idle, closed %v; want kept open", len(p.idle), isClosed(first))
+	}
+
+	// Неиспользуемый файл выдаётся снова без повторного открытия
+	again, release := openPooled(t, p, paths[0])
+	if again != first {
+		t.Errorf("idle file was reopened")
+	}
+	release()
+}
+
+func TestFilePoolLimit(t *testing.T) {
+	paths := poolFiles(t, "a", "b", "c")
+	p := NewFilePool(2)
+	defer p.Close()
+
+	a, releaseA := openPooled(t, p, paths[0])
+	_, releaseB := openPooled(t, p, paths[1])
+
+	// Все места заняты файлами, которые читают: Open ждёт возврата
+	opened := make(chan func())
+	go func() {
+		_, release, err := p.Open(paths[2])
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- release
+	}()
+	select {
+	case <-opened:
+		t.Fatal("Open exceeded the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Возвращённый файл закрывается, чтобы открыть ждущий
+	releaseA()
+	select {
+	case releaseC := <-opened:
+		releaseC()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Open still waits after a file was released")
+	}
+	if !isClosed(a) || p.files[paths[0]] != nil {
+		t.Errorf("idle file was not closed to make room")
+	}
+	if p.open != 2 {
+		t.Errorf("%d files open, limit 2", p.open)
+	}
+	releaseB()
+}
+
+func TestFilePoolOpenError(t *testing.T) {
+	paths := poolFiles(t, "a")
+	p := NewFilePool(1)
+	defer p.Close()
+
+	if _, _, err := p.Open(filepath.Join(filepath.Dir(paths[0]), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v", err)
+	}
+	// Место, занятое под неудачное открытие, освобождается
+	if p.open != 0 {
+		t.Fatalf("%d files open after a failed Open", p.open)
+	}
+	_, release := openPooled(t, p, paths[0])
+	release()
+}
+
+func TestFilePoolCloseIdleAndClose(t *testing.T) {
+	paths := poolFiles(t, "a", "b")
+	p := NewFilePool(4)
+
+	a, releaseA := openPooled(t, p, paths[0])
+	releaseA()
+	b, releaseB := openPooled(t, p, paths[1])
+
+	// CloseIdle закрывает только неиспользуемые файлы, пул продолжает работать
+	p.CloseIdle()
+	if !isClosed(a) || isClosed(b) {
+		t.Errorf("CloseIdle: a closed %v, b closed %v; want true, false", isClosed(a), isClosed(b))
+	}
+	reopened, releaseA := openPooled(t, p, paths[0])
+	if reopened == a || isClosed(reopened) {
+		t.Errorf("file needed again was not reopened")
+	}
+	releaseA()
+
+	// Close закрывает файлы, которые ещё читают, при их возврате
+	p.Close()
+	if !isClosed(reopened) || isClosed(b) {
+		t.Errorf("Close: idle closed %v, in use closed %v; want true, false", isClosed(reopened), isClosed(b))
+	}
+	releaseB()
+	if !isClosed(b) || p.open != 0 {
+		t.Errorf("file released after Close: closed %v, %d open", isClosed(b), p.open)
+	}
+}
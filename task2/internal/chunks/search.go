@@ -0,0 +1,171 @@
+package chunks
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LineProbe - проверка строки при двоичном поиске по упорядоченному файлу.
+// known == false, если по строке нельзя судить о её положении (например, в ней нет
+// метки времени) - такая строка относится к предыдущей; before == true, если строка
+// лежит до искомой границы
+type LineProbe func(line []byte) (before, known bool)
+
+// probeMinSpan - при каком размере оставшейся области двоичный поиск
+// сменяется последовательным просмотром строк
+const probeMinSpan = 64 * 1024
+
+// SearchLineOffset - находит начало первой строки, для которой probe сообщает
+// before == false, в файле, строки которого упорядочены относительно probe.
+// Читается O(log(fileSize)) небольших участков файла. Если такой строки нет, возвращает fileSize
+func SearchLineOffset(file *os.File, fileSize int64, probe LineProbe) (int64, error) {
+	// Граница не раньше lo; если lo > 0, строка, закончившаяся в lo, лежит до границы
+	lo, hi := int64(0), fileSize
+	for hi-lo > probeMinSpan {
+		mid := lo + (hi-lo)/2
+		start, err := nextLineStart(file, mid, fileSize)
+		if err != nil {
+			return 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
+		}
+
+		offset, next, before, found, err := probeFrom(file, fileSize, start, hi, probe)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case !found:
+			// Между mid и hi нет строк с известным положением
+			hi = mid
+		case before:
+			lo = next
+		default:
+			hi = offset
+		}
+	}
+
+	// Оставшуюся область просматриваем построчно; граница может оказаться и дальше hi,
+	// если перед ним шли строки без известного положения
+	start, err := nextLineStart(file, lo, fileSize)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
+	}
+	return scanBoundary(file, fileSize, start, probe)
+}
+
+// probeFrom - первая строка с известным положением, начинающаяся в [start, limit):
+// её начало, начало следующей строки и результат probe
+func probeFrom(file *os.File, fileSize, start, limit int64, probe LineProbe) (offset, next int64, before, found bool, err error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, start, fileSize-start))
+	offset = start
+	for offset < limit {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) == 0 && readErr != nil {
+			break
+		}
+		next = offset + int64(len(line))
+		if before, known := probe(trimLineEnd(line)); known {
+			return offset, next, before, true, nil
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return 0, 0, false, false, fmt.Errorf("error reading %s: %v", file.Name(), readErr)
+		}
+		offset = next
+	}
+	return 0, 0, false, false, nil
+}
+
+// scanBoundary - построчно ищет с позиции start первую строку с известным положением,
+// для которой before == false
+func scanBoundary(file *os.File, fileSize, start int64, probe LineProbe) (int64, error) {
+	for start < fileSize {
+		offset, next, before, found, err := probeFrom(file, fileSize, start, fileSize, probe)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return fileSize, nil
+		}
+		if !before {
+			return offset, nil
+		}
+		start = next
+	}
+	return fileSize, nil
+}
+
+// CountLines - количество строк файла, начинающихся до смещения end
+// (end должен быть началом строки)
+func CountLines(file *os.File, end int64) (int, error) {
+	buf := make([]byte, 1024*1024)
+	count := 0
+	for offset := int64(0); offset < end; {
+		size := int64(len(buf))
+		if end-offset < size {
+			size = end - offset
+		}
+		n, err := file.ReadAt(buf[:size], offset)
+		count += bytes.Count(buf[:n], []byte{'\n'})
+		offset += int64(n)
+		if err != nil && !(err == io.EOF && offset >= end) {
+			return 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
+		}
+	}
+	return count, nil
+}
+
+// trimLineEnd - строка без символов перевода строки
+func trimLineEnd(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	return bytes.TrimSuffix(line, []byte{'\r'})
+}
+
+// SkipLines - смещение начала строки, которая идёт через n строк после offset
+// (offset должен быть началом строки). Если строк меньше, возвращает fileSize.
+// Переводы строк считаются блоками, без разбора строк
+func SkipLines(file *os.File, fileSize, offset int64, n int) (int64, error) {
+	buf := make([]byte, 1024*1024)
+	for n > 0 && offset < fileSize {
+		size := int64(len(buf))
+		if fileSize-offset < size {
+			size = fileSize - offset
+		}
+		read, err := file.ReadAt(buf[:size], offset)
+		if read == 0 && err != nil {
+			return 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
+		}
+		block := buf[:read]
+
+		if count := bytes.Count(block, []byte{'\n'}); count < n {
+			n -= count
+			offset += int64(read)
+			continue
+		}
+		// Нужный перевод строки в этом блоке
+		for pos := 0; ; n-- {
+			i := bytes.IndexByte(block[pos:], '\n')
+			pos += i + 1
+			if n == 1 {
+				return offset + int64(pos), nil
+			}
+		}
+	}
+	if offset > fileSize {
+		offset = fileSize
+	}
+	return offset, nil
+}
+
+// LineStartAfter - начало первой строки, начинающейся не раньше offset
+func LineStartAfter(file *os.File, fileSize, offset int64) (int64, error) {
+	start, err := nextLineStart(file, offset, fileSize)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %v", file.Name(), err)
+	}
+	return start, nil
+}
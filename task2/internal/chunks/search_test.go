@@ -0,0 +1,118 @@
+package chunks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numberedLog - журнал из n упорядоченных записей "%08d ..."; после каждой
+// every-й записи идут строки продолжения без номера
+func numberedLog(n, every int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%08d record\n", i*2)
+		if i%every == 0 {
+			b.WriteString("    continuation line\n\n")
+		}
+	}
+	return b.String()
+}
+
+// lessThan - проверка строк журнала numberedLog: до границы лежат записи с номером меньше limit
+func lessThan(limit int) LineProbe {
+	return func(line []byte) (bool, bool) {
+		if len(line) < 8 {
+			return false, false
+		}
+		n, err := strconv.Atoi(string(line[:8]))
+		if err != nil {
+			return false, false
+		}
+		return n < limit, true
+	}
+}
+
+// linearBoundary - граница, найденная просмотром всех строк
+func linearBoundary(data string, probe LineProbe) int64 {
+	offset := 0
+	for _, line := range strings.SplitAfter(data, "\n") {
+		if before, known := probe([]byte(strings.TrimSuffix(line, "\n"))); known && !before {
+			return int64(offset)
+		}
+		offset += len(line)
+	}
+	return int64(len(data))
+}
+
+func TestSearchLineOffset(t *testing.T) {
+	// Файл больше probeMinSpan, чтобы работал двоичный поиск, а не только просмотр
+	data := numberedLog(20000, 7)
+	if len(data) < 4*probeMinSpan {
+		t.Fatalf("log is too small: %d bytes", len(data))
+	}
+	file := tempFile(t, data)
+	size := int64(len(data))
+
+	for _, limit := range []int{-1, 0, 1, 2, 3, 777, 13999, 14000, 20001, 39997, 39998, 39999, 50000} {
+		probe := lessThan(limit)
+		got, err := SearchLineOffset(file, size, probe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := linearBoundary(data, probe); got != want {
+			t.Errorf("limit %d: boundary %d, want %d", limit, got, want)
+		}
+	}
+}
+
+func TestSearchLineOffsetUnknownLines(t *testing.T) {
+	// Длинный участок без меток: граница находится за ним
+	data := numberedLog(3000, 1000) + strings.Repeat("no timestamp here\n", 20000) + "99999999 last\n"
+	file := tempFile(t, data)
+	size := int64(len(data))
+	for _, limit := range []int{5000, 99999999, 100000000} {
+		probe := lessThan(limit)
+		got, err := SearchLineOffset(file, size, probe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := linearBoundary(data, probe); got != want {
+			t.Errorf("limit %d: boundary %d, want %d", limit, got, want)
+		}
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	file := tempFile(t, "a\nbb\n\nccc\nd")
+	for end, want := range map[int64]int{0: 0, 2: 1, 5: 2, 6: 3, 10: 4} {
+		if got, err := CountLines(file, end); err != nil || got != want {
+			t.Errorf("CountLines(%d) = %d, %v; want %d", end, got, err, want)
+		}
+	}
+}
+
+func TestSkipLines(t *testing.T) {
+	data := "a\nbb\n\nccc\nd"
+	file := tempFile(t, data)
+	size := int64(len(data))
+	tests := []struct {
+		offset int64
+		n      int
+		want   int64
+	}{
+		{0, 0, 0},
+		{0, 1, 2},
+		{0, 3, 6},
+		{2, 2, 6},
+		{0, 4, 10},
+		{0, 5, size}, // последняя строка без перевода
+		{6, 10, size},
+	}
+	for _, tt := range tests {
+		if got, err := SkipLines(file, size, tt.offset, tt.n); err != nil || got != tt.want {
+			t.Errorf("SkipLines(%d, %d) = %d, %v; want %d", tt.offset, tt.n, got, err, tt.want)
+		}
+	}
+}
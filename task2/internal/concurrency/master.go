@@ -1,54 +1,131 @@
 package concurrency
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"sync"
 
 	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
 	"github.com/pozedorum/WB_project_4/task2/internal/models"
 	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/rewrite"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
 )
 
 type Master struct {
 	workers      []*Worker
 	taskChan     chan models.Task
 	resultChan   chan models.Result
-	totalTasks   int
+	totalChunks  int // чанков во всех задачах: задача может объединять чанки маленьких файлов
 	totalFiles   int
 	resultMap    map[int]models.Result
 	resultMutex  sync.RWMutex
-	done         chan bool
+	done         chan struct{}
+	doneOnce     sync.Once
+	closeOnce    sync.Once      // канал задач закрывается один раз
+	pending      sync.WaitGroup // результаты отправленных чанков, которые ещё не собраны
+	received     int            // собрано результатов
 	progressChan chan int
 	taskCounter  int
 	wg           sync.WaitGroup // Добавляем WaitGroup для отслеживания воркеров
+	ctx          context.Context
+	cancel       context.CancelFunc
+	quiet        bool // -q: остановиться на первой выбранной строке
+	found        bool // найдена хотя бы одна выбранная строка
+	stitcher     *stitcher
+	rewriteErrs  []error
+	csv          bool // --csv: не разрывать записи с переводами строк внутри кавычек
+	scope        *scope.Scope
+	planner      *chunks.Planner
+	split        *splitter
+	reverse      bool               // --reverse, --tail-matches: файлы читаются от конца к началу
+	tailLimit    int                // --tail-matches: сколько выбранных строк нужно с конца файла
+	needLines    bool               // выводятся номера строк
+	slots        chan struct{}      // при чтении с конца в работе не больше чанков, чем воркеров
+	tails        map[int]*tailState // ход чтения файлов с конца по номерам файлов
+	changed      map[string]bool    // файлы, об изменении которых уже предупреждали
+	mappings     *chunks.Mappings   // --mmap: файлы, отображённые в память для воркеров
+	files        *chunks.FilePool   // открытые файлы, общие для разметки и воркеров
+	flags        *options.FlagStruct
+	overlap      int64 // -U: перекрытие чанков, не меньше их размера
+}
+
+// tailState - ход чтения одного файла с конца
+type tailState struct {
+	nextID      int         // ID чанка, результат которого учитывается следующим (чанки идут от конца файла)
+	pending     map[int]int // выбранных строк в полученных, но ещё не учтённых чанках
+	found       int         // выбранных строк в учтённых чанках - непрерывной части от конца файла
+	enough      bool        // найдено tailLimit строк, более ранние чанки не нужны
+	linesBefore int         // строк файла до самого раннего просмотренного чанка
 }
 
 const (
 	standardChanSize = 100
 )
 
-func NewMaster(workersCount int, flags *options.FlagStruct) (*Master, error) {
+// NewMaster - создаёт мастера и запускает воркеров; searchScope - область поиска в файлах
+func NewMaster(workersCount int, flags *options.FlagStruct, searchScope *scope.Scope) (*Master, error) {
 	workers := make([]*Worker, 0, workersCount)
 	taskChan := make(chan models.Task, standardChanSize)
 	resultChan := make(chan models.Result, standardChanSize)
 	resultMap := make(map[int]models.Result, standardChanSize)
+	planner, err := chunks.NewPlanner(*flags.ChunkSizeFlag, workersCount)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := flags.ChangePolicy()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	files := chunks.NewFilePool(*flags.MaxOpenFlag)
 
 	master := &Master{
 		workers:      workers,
 		taskChan:     taskChan,
 		resultChan:   resultChan,
-		done:         make(chan bool),
+		done:         make(chan struct{}),
 		progressChan: make(chan int, standardChanSize), // Увеличиваем буфер
 		taskCounter:  0,
 		resultMap:    resultMap,
+		ctx:          ctx,
+		cancel:       cancel,
+		quiet:        *flags.QuietFlag,
+		csv:          *flags.CSVFlag,
+		scope:        searchScope,
+		planner:      planner,
+		split:        newSplitter(flags, searchScope, files, workersCount),
+		reverse:      flags.TailMode(),
+		tailLimit:    *flags.TailMatchesFlag,
+		needLines:    flags.NeedLineNumbers(),
+		slots:        make(chan struct{}, workersCount),
+		tails:        make(map[int]*tailState),
+		changed:      make(map[string]bool),
+		files:        files,
+		flags:        flags,
+	}
+	if *flags.MmapFlag {
+		// Отображения, с которыми никто не работает, держим по одному на воркера
+		master.mappings = chunks.NewMappings(workersCount)
+	}
+
+	if flags.Operation() == models.OperationReplace {
+		// Переписанные чанки сразу собираются в файлы по порядку
+		master.stitcher = newStitcher(rewrite.Options{
+			Backup: *flags.BackupFlag,
+			DryRun: *flags.DryRunFlag,
+			Diff:   os.Stdout,
+		})
 	}
 
 	// Создаем и запускаем воркеры
 	for id := 0; id < workersCount; id++ {
 		master.wg.Add(1) // Увеличиваем счетчик для каждого воркера
-		newWorker := newWorker(id, &master.wg, taskChan, resultChan, flags)
+		newWorker := newWorker(ctx, id, &master.wg, taskChan, resultChan, flags, policy, master.mappings, files)
 		master.workers = append(master.workers, newWorker)
 
 	}
@@ -59,53 +136,287 @@ func NewMaster(workersCount int, flags *options.FlagStruct) (*Master, error) {
 	return master, nil
 }
 
-// ProcessFilesStreaming - потоковая обработка файлов
-func (m *Master) ProcessFilesStreaming(files []*os.File, operation, pattern string) error {
-	m.totalFiles = len(files)
+// ProcessFilesStreaming - потоковая обработка файлов. Файлы открываются только
+// на время разметки и обработки своих чанков
+func (m *Master) ProcessFilesStreaming(paths []string, operation, pattern string) error {
+	m.totalFiles = len(paths)
 	// Запускаем потоковое создание задач в отдельной горутине
-	go m.createTasksStreaming(files, operation, pattern)
+	if m.reverse {
+		go m.createTasksReverse(paths, operation, pattern)
+	} else {
+		go m.createTasksStreaming(paths, operation, pattern)
+	}
 
 	// Ждем завершения сбора результатов
 	<-m.done
 
-	// log.Printf("Processing completed: %d tasks processed", m.totalTasks)
+	// log.Printf("Processing completed: %d tasks processed", m.taskCounter)
+	return nil
+}
+
+// ProcessChunks - обработка заранее размеченных чанков (например, дописанных
+// в файлы данных при --follow); чанки одного файла должны идти подряд, ID - от нуля.
+// Мастера можно вызывать повторно: результаты предыдущего вызова отбрасываются,
+// воркеры работают до Close
+func (m *Master) ProcessChunks(fileChunks []chunks.Chunk, operation, pattern string) error {
+	m.resultMutex.Lock()
+	m.resultMap = make(map[int]models.Result, len(fileChunks))
+	m.totalChunks, m.overlap = 0, 0
+	m.resultMutex.Unlock()
+
+	var totalSize int64
+	for _, chunk := range fileChunks {
+		totalSize += chunk.GetChunkSize()
+		m.overlap = max(m.overlap, chunk.GetChunkSize())
+	}
+	batcher := chunks.NewBatcher(m.planner.ChunkSize(totalSize))
+	if m.sendChunks(batcher, fileChunks, operation, pattern) {
+		m.sendTask(batcher.Flush(), operation, pattern)
+	}
+
+	m.pending.Wait()
+	// К следующему вызову файл по пути может быть уже другим (ротация журнала)
+	m.files.CloseIdle()
 	return nil
 }
 
+// Close - останавливает воркеров и закрывает файлы мастера, обработавшего чанки через
+// ProcessChunks (после ProcessFilesStreaming воркеры уже остановлены)
+func (m *Master) Close() {
+	m.closeTasks()
+	<-m.done
+}
+
+// closeTasks - закрывает канал задач: воркеры завершаются, обработав оставшиеся задачи
+func (m *Master) closeTasks() {
+	m.closeOnce.Do(func() {
+		close(m.taskChan)
+	})
+}
+
+// Found - была ли найдена хотя бы одна выбранная строка (для -q)
+func (m *Master) Found() bool {
+	return m.found
+}
+
+// RewriteErrors - ошибки перезаписи файлов (для операции replace)
+func (m *Master) RewriteErrors() []error {
+	return m.rewriteErrs
+}
+
+// finish - сообщает ProcessFilesStreaming о завершении обработки (однократно)
+func (m *Master) finish() {
+	m.doneOnce.Do(func() {
+		close(m.done)
+	})
+}
+
 // createTasksStreaming - потоково создает задачи и отправляет в канал
-func (m *Master) createTasksStreaming(files []*os.File, operation, pattern string) {
-	defer close(m.taskChan) // Гарантируем закрытие канала задач
+func (m *Master) createTasksStreaming(paths []string, operation, pattern string) {
+	defer m.closeTasks() // Гарантируем закрытие канала задач
+	chunkSize := m.planner.ChunkSize(totalSize(paths))
+	m.overlap = chunkSize
+	batcher := chunks.NewBatcher(chunkSize)
 	lastChunkID := 0
-	for _, file := range files {
-		// log.Printf("Splitting file: %s", file.Name())
+	for index, planned := range m.split.planFiles(m.ctx, paths, chunkSize) {
+		var plan filePlan
+		select {
+		case plan = <-planned:
+		case <-m.ctx.Done():
+			return
+		}
+		if plan.err != nil {
+			log.Printf("Error splitting file %s: %v", plan.path, plan.err)
+			continue
+		}
+
+		// Файлы размечались независимо: ID чанков продолжают нумерацию по порядку файлов
+		for i := range plan.chunks {
+			plan.chunks[i].ChunkID += lastChunkID
+			plan.chunks[i].FileIndex = index
+		}
+		lastChunkID += len(plan.chunks)
+		if !m.sendChunks(batcher, plan.chunks, operation, pattern) {
+			return
+		}
+	}
+	m.sendTask(batcher.Flush(), operation, pattern)
+	// log.Printf("All tasks created: %d total tasks", m.taskCounter)
+}
+
+// sendChunks - отправляет чанки в канал задач; чанки маленьких файлов batcher
+// копит и объединяет в общие задачи. false, если обработка остановлена
+func (m *Master) sendChunks(batcher *chunks.Batcher, fileChunks []chunks.Chunk, operation, pattern string) bool {
+	for _, chunk := range fileChunks {
+		// fmt.Println("chunk id ", chunk.ChunkID)
+		// fmt.Println("chunk start offset ", chunk.StartOffset)
+		// fmt.Println("chunk end offset ", chunk.EndOffset)
+		if batch := batcher.Add(chunk); batch != nil && !m.sendTask(batch, operation, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendTask - отправляет задачу из одного или нескольких чанков; false, если обработка остановлена
+func (m *Master) sendTask(batch []chunks.Chunk, operation, pattern string) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	task := models.Task{
+		ID:        m.taskCounter,
+		Operation: operation,
+		Pattern:   pattern,
+		Chunk:     batch[0],
+		Overlap:   m.overlap,
+	}
+	if len(batch) > 1 {
+		task.Batch = batch
+	}
+	// log.Printf("Task %d created for file %s", task.ID, batch[0].FilePath)
+	return m.dispatch(task)
+}
+
+// dispatch - передаёт задачу воркерам; false, если обработка остановлена
+func (m *Master) dispatch(task models.Task) bool {
+	parts := len(task.Parts())
+	// Учитываем заранее: результат может прийти раньше, чем закончится отправка
+	m.pending.Add(parts)
+	select {
+	case m.taskChan <- task:
+	case <-m.ctx.Done():
+		// Обработка остановлена (-q), новые задачи не нужны
+		m.pending.Add(-parts)
+		return false
+	}
+	m.taskCounter++
+	m.resultMutex.Lock()
+	m.totalChunks += parts
+	m.resultMutex.Unlock()
+	return true
+}
+
+// createTasksReverse - создаёт задачи по чанкам от конца файлов к началу (--reverse,
+// --tail-matches). Вперёд берётся не больше чанков, чем воркеров, и, как только
+// с конца файла найдено tailLimit выбранных строк, более ранние чанки не создаются
+func (m *Master) createTasksReverse(paths []string, operation, pattern string) {
+	defer m.closeTasks()
+	chunkSize := m.planner.ChunkSize(totalSize(paths))
+	chunkID := 0
+	for index, path := range paths {
+		if !m.reverseFile(path, index, &chunkID, chunkSize, operation, pattern) {
+			return
+		}
+	}
+}
+
+// reverseFile - создаёт задачи по чанкам одного файла от конца к началу; false, если
+// обработка остановлена. Файл открывается отдельно от пула воркеров: задачи ждут
+// свободных воркеров, и занятое место в пуле могло бы им понадобиться
+func (m *Master) reverseFile(path string, index int, chunkID *int, chunkSize int64, operation, pattern string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error splitting file %s: %v", path, err)
+		return true
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("Error splitting file %s: %v", file.Name(), err)
+		return true
+	}
+	region := scope.Region{End: info.Size()}
+	if m.scope.Active() {
+		if region, err = m.scope.Resolve(file, info.Size()); err != nil {
+			log.Printf("Error splitting file %s: %v", file.Name(), err)
+			return true
+		}
+	}
+
+	state := &tailState{nextID: *chunkID, pending: make(map[int]int)}
+	m.resultMutex.Lock()
+	m.tails[index] = state
+	m.resultMutex.Unlock()
+
+	reverse := chunks.NewReverseChunks(file, region.Start, region.End, info.Size(), chunkSize)
+	for first := true; ; first = false {
+		select {
+		case m.slots <- struct{}{}:
+		case <-m.ctx.Done():
+			return false
+		}
+		if m.tailEnough(state) {
+			<-m.slots
+			break
+		}
 
-		// Разбиваем файл на чанки
-		fileChunks, newLastChunkID, err := chunks.SplitFiles([]*os.File{file}, lastChunkID)
+		chunk, ok, err := reverse.Next(*chunkID)
 		if err != nil {
 			log.Printf("Error splitting file %s: %v", file.Name(), err)
-			continue
 		}
-		lastChunkID = newLastChunkID
-		// Отправляем чанки в канал задач
-		for _, chunk := range fileChunks {
-			// fmt.Println("chunk id ", chunk.ChunkID)
-			// fmt.Println("chunk start offset ", chunk.StartOffset)
-			// fmt.Println("chunk end offset ", chunk.EndOffset)
-			task := models.Task{
-				ID:        m.taskCounter,
-				Operation: operation,
-				Pattern:   pattern,
-				Chunk:     chunk,
-			}
+		if !ok && first {
+			// Пустая область: файл всё равно попадает в результат (например, для -c)
+			chunk, ok = chunks.Chunk{FilePath: file.Name(), StartOffset: region.End, EndOffset: region.End, ChunkID: *chunkID, FileSize: info.Size(), Fingerprint: chunks.NewFingerprint(info)}, true
+		}
+		if !ok {
+			<-m.slots
+			break
+		}
+		chunk.FileIndex = index
 
-			m.taskChan <- task
-			m.taskCounter++
-			m.totalTasks++
+		task := models.Task{
+			ID:        m.taskCounter,
+			Operation: operation,
+			Pattern:   pattern,
+			Chunk:     chunk,
+		}
+		if !m.dispatch(task) {
+			return false
+		}
+		*chunkID++
+	}
 
-			// log.Printf("Task %d created for file %s", task.ID, file.Name())
+	// Номера строк отсчитываются от начала файла
+	if m.needLines {
+		lines, err := chunks.CountLines(file, reverse.Offset())
+		if err != nil {
+			log.Printf("Error counting lines in %s: %v", file.Name(), err)
+		}
+		m.resultMutex.Lock()
+		state.linesBefore = lines
+		m.resultMutex.Unlock()
+	}
+	return true
+}
+
+// tailEnough - найдено ли с конца файла достаточно выбранных строк
+func (m *Master) tailEnough(state *tailState) bool {
+	m.resultMutex.RLock()
+	defer m.resultMutex.RUnlock()
+	return state.enough
+}
+
+// countTail - учитывает выбранные строки чанка; строки считаются найденными,
+// только когда получены все чанки между ним и концом файла
+func (m *Master) countTail(result models.Result) {
+	state, ok := m.tails[result.FileIndex]
+	if !ok {
+		return
+	}
+	state.pending[result.ChunkID] = grep.CountSelected(result.Matches)
+	for {
+		count, ok := state.pending[state.nextID]
+		if !ok {
+			break
 		}
+		delete(state.pending, state.nextID)
+		state.found += count
+		state.nextID++
+	}
+	if m.tailLimit > 0 && state.found >= m.tailLimit {
+		state.enough = true
 	}
-	// log.Printf("All tasks created: %d total tasks", m.totalTasks)
 }
 
 // resultCollector собирает результаты из канала
@@ -115,55 +426,216 @@ func (m *Master) resultCollector() {
 		close(m.resultChan)
 	}()
 
-	receivedResults := 0
 	for result := range m.resultChan {
-		m.resultMutex.Lock()
-		m.resultMap[result.ChunkID] = result
-		m.resultMutex.Unlock()
-
-		receivedResults++
-
-		select {
-		case m.progressChan <- receivedResults:
-		default:
-		}
+		m.collect(result)
+		// ProcessChunks ждёт, пока будут собраны результаты всех отправленных чанков
+		m.pending.Done()
+	}
 
-		if receivedResults >= m.totalTasks {
-			break
+	if m.stitcher != nil {
+		m.rewriteErrs = m.stitcher.close()
+	}
+	// Воркеры завершились: дескрипторы больше не нужны
+	m.files.Close()
+	if m.mappings != nil {
+		// Воркеры завершились, строки результатов скопированы из отображений
+		if err := m.mappings.Close(); err != nil {
+			log.Printf("Error unmapping files: %v", err)
 		}
 	}
 
 	close(m.progressChan)
-	m.done <- true
+	m.finish()
 }
 
-// MergeResults объединяет все результаты
-func (m *Master) MergeResults() []string {
-	var allLines []string
+// collect - учитывает результат чанка
+func (m *Master) collect(result models.Result) {
+	if m.reverse {
+		// Освобождаем место для следующего чанка
+		<-m.slots
+	}
+	if m.ctx.Err() != nil {
+		// Обработка остановлена, оставшиеся результаты просто вычитываем
+		return
+	}
+	if m.quiet && hasSelected(result) {
+		// Ответ уже известен: отменяем остальные задачи и не ждём их
+		m.found = true
+		m.cancel()
+		m.finish()
+		return
+	}
+	if result.Changed && !m.changed[result.FilePath] {
+		// --on-change=warn: файл читается как есть, предупреждаем один раз
+		m.changed[result.FilePath] = true
+		fmt.Fprintf(os.Stderr, "grep: %s: warning: %v\n", result.FilePath, chunks.ErrFileChanged)
+	}
+
+	if m.stitcher != nil {
+		m.stitcher.add(result)
+		m.received++
+		return
+	}
+
+	m.resultMutex.Lock()
+	m.resultMap[result.ChunkID] = result
+	if m.reverse {
+		m.countTail(result)
+	}
+	m.resultMutex.Unlock()
+
+	m.received++
+
+	select {
+	case m.progressChan <- m.received:
+	default:
+	}
+}
+
+// hasSelected - есть ли в результате выбранная (не контекстная) строка.
+// Для диапазонов --from/--to выбор в начале чанка зависит от предыдущих чанков,
+// поэтому строка считается найденной, только если она выбрана в обоих вариантах
+func hasSelected(result models.Result) bool {
+	if result.Range == nil {
+		return selectedAfter(result.Matches, 0)
+	}
+	if selectedAfter(result.Matches, result.Range.OpenLines) {
+		return true
+	}
+	return selectedAfter(result.Matches, 0) && selectedAfter(result.Range.OpenMatches, 0)
+}
+
+// selectedAfter - есть ли выбранная строка с номером больше line
+func selectedAfter(matches []models.Match, line int) bool {
+	for _, match := range matches {
+		if match.Kind == models.KindMatch && match.LineNumber > line {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeFiles объединяет результаты чанков по файлам в исходном порядке.
+// Номера строк в каждом чанке пересчитываются от начала файла, диапазоны
+// --from/--to переносятся из чанка в чанк по порядку.
+func (m *Master) MergeFiles() []models.FileResult {
+	var files []models.FileResult
+	var group []models.Result // результаты чанков текущего файла
 
 	m.resultMutex.RLock()
 	defer m.resultMutex.RUnlock()
 
-	for chunkID := 0; chunkID < m.totalTasks; chunkID++ {
-		if result, exists := m.resultMap[chunkID]; exists {
-			if result.Error == nil {
-				allLines = append(allLines, m.AddPath(result.Lines, result.FilePath)...)
-			} else {
-				allLines = append(allLines, fmt.Sprintf("error with file %s: %v", result.FilePath, result.Error))
-			}
-		} else {
-			allLines = append(allLines, fmt.Sprintf("error: missing result for chunk %d", chunkID))
+	flush := func() {
+		if len(group) > 0 {
+			files = append(files, m.mergeFile(group))
+			group = nil
 		}
 	}
-	return allLines
+	for chunkID := 0; chunkID < m.totalChunks; chunkID++ {
+		result, exists := m.resultMap[chunkID]
+		if !exists {
+			flush()
+			files = append(files, models.FileResult{Error: fmt.Errorf("missing result for chunk %d", chunkID)})
+			continue
+		}
+		if len(group) > 0 && group[0].FileIndex != result.FileIndex {
+			flush()
+		}
+		group = append(group, result)
+	}
+	flush()
+	return files
 }
 
-func (m *Master) AddPath(lines []string, filepath string) []string {
-	if m.totalFiles == 1 {
-		return lines
+// mergeFile - объединяет результаты чанков одного файла
+func (m *Master) mergeFile(group []models.Result) models.FileResult {
+	// Номера строк отсчитываются от начала файла, даже если поиск начат не с него
+	linesBefore := group[0].LinesBefore
+	if m.reverse {
+		// Чанки создавались от конца файла к началу
+		ordered := make([]models.Result, len(group))
+		for i, result := range group {
+			ordered[len(group)-1-i] = result
+		}
+		group = ordered
+		if state, ok := m.tails[group[0].FileIndex]; ok {
+			linesBefore = state.linesBefore
+		}
 	}
-	for ind, line := range lines {
-		lines[ind] = fmt.Sprintf("%s:%s", filepath, line)
+
+	file := models.FileResult{FilePath: group[0].FilePath, FileIndex: group[0].FileIndex, LineCount: linesBefore}
+	edges := make(map[int]models.Match)
+	rangeOpen := false
+	for _, result := range group {
+		if result.Error != nil {
+			file.Error = result.Error
+			continue
+		}
+
+		if result.LinesBefore > file.LineCount {
+			// Чанки из плана (--plan-in) могут идти с пропусками, их строки известны заранее
+			file.LineCount = result.LinesBefore
+		}
+		matches := result.Matches
+		if result.Range != nil {
+			// Блок --from/--to, открытый в предыдущем чанке, продолжается в этом
+			matches, rangeOpen = result.Range.Resolve(matches, rangeOpen)
+		}
+		for _, match := range matches {
+			match.LineNumber += file.LineCount
+			file.Matches = appendMatch(file.Matches, match)
+		}
+		for _, edge := range result.Edges {
+			edge.LineNumber += file.LineCount
+			edges[edge.LineNumber] = edge
+		}
+		file.LineCount += result.LineCount
+		file.ByteCount += result.ByteCount
+		file.Elapsed += result.Elapsed
+	}
+	// Контекст на границах чанков берётся из крайних строк соседей
+	file.Matches = grep.EdgeContext(file.Matches, edges, *m.flags)
+	return file
+}
+
+// appendMatch - добавляет строку к результату файла, сохраняя порядок номеров строк.
+// В многострочном режиме чанки выводят строки из перекрытия с соседями,
+// поэтому одна строка может прийти дважды: остаётся одна, выбранная важнее контекста
+func appendMatch(matches []models.Match, match models.Match) []models.Match {
+	pos := len(matches)
+	for pos > 0 && matches[pos-1].LineNumber >= match.LineNumber {
+		pos--
+	}
+	if pos < len(matches) && matches[pos].LineNumber == match.LineNumber {
+		if match.Kind == models.KindMatch && matches[pos].Kind == models.KindContext {
+			matches[pos] = match
+		} else if match.Kind == models.KindMatch {
+			matches[pos].Submatches = mergeSubmatches(matches[pos].Submatches, match.Submatches)
+		}
+		return matches
+	}
+
+	matches = append(matches, models.Match{})
+	copy(matches[pos+1:], matches[pos:])
+	matches[pos] = match
+	return matches
+}
+
+// mergeSubmatches - объединяет вхождения одной строки, найденные разными чанками
+func mergeSubmatches(a, b []models.Submatch) []models.Submatch {
+	result := append([]models.Submatch{}, a...)
+	for _, sub := range b {
+		exists := false
+		for _, have := range a {
+			if have.Start == sub.Start && have.End == sub.End {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			result = append(result, sub)
+		}
 	}
-	return lines
+	sort.Slice(result, func(i, j int) bool { return result[i].Start < result[j].Start })
+	return result
 }
@@ -0,0 +1,103 @@
+package concurrency
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
+)
+
+// writeFile - создаёт файл name с содержимым data во временном каталоге dir
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runMaster - ищет по файлам paths мастером с workers воркерами; args - флаги и шаблон
+func runMaster(t *testing.T, workers int, paths []string, args ...string) *Master {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatalf("parse %q: %v", args, err)
+	}
+	searchScope, err := scope.New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := NewMaster(workers, fs, searchScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := master.ProcessFilesStreaming(paths, models.OperationGrep, fs.Pattern); err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+func TestQuietStopsOnFirstSelectedLine(t *testing.T) {
+	dir := t.TempDir()
+	line := "nothing to see here\n"
+	var paths []string
+	for _, name := range []string{"a", "b", "c"} {
+		paths = append(paths, writeFile(t, dir, name, strings.Repeat(line, 200)))
+	}
+	paths = append(paths, writeFile(t, dir, "d", strings.Repeat(line, 100)+"needle\n"+strings.Repeat(line, 100)))
+
+	if master := runMaster(t, 4, paths, "-q", "--chunk-size", "256", "needle"); !master.Found() {
+		t.Error("-q did not find the selected line")
+	}
+	if master := runMaster(t, 4, paths, "-q", "--chunk-size", "256", "missing"); master.Found() {
+		t.Error("-q found a line that is not there")
+	}
+	// -v: выбрана любая строка без вхождения
+	if master := runMaster(t, 2, paths[:1], "-q", "-v", "--chunk-size", "256", "nothing"); master.Found() {
+		t.Error("-q -v found a line although every line matches")
+	}
+}
+
+func TestQuietRangeAcrossChunks(t *testing.T) {
+	// Первый чанк - только строка, открывающая блок (сама она не выводится), строки
+	// блока лежат в следующих чанках: в каждом чанке по отдельности ничего не выбрано
+	data := "begin" + strings.Repeat(".", 80) + "\n" + strings.Repeat("inside\n", 50)
+	path := writeFile(t, t.TempDir(), "r", data)
+
+	master := runMaster(t, 3, []string{path}, "-q", "--chunk-size", "64", "--from", "begin", "--exclude-from")
+	found := master.Found()
+	for _, res := range master.MergeFiles() {
+		found = found || len(res.Matches) > 0
+	}
+	if !found {
+		t.Error("-q missed a --from block that spans chunks")
+	}
+}
+
+func TestHasSelected(t *testing.T) {
+	match := func(line int) models.Match { return models.Match{LineNumber: line, Kind: models.KindMatch} }
+	context := func(line int) models.Match { return models.Match{LineNumber: line, Kind: models.KindContext} }
+	tests := []struct {
+		name   string
+		result models.Result
+		want   bool
+	}{
+		{"no lines", models.Result{}, false},
+		{"context only", models.Result{Matches: []models.Match{context(1)}}, false},
+		{"selected", models.Result{Matches: []models.Match{context(1), match(2)}}, true},
+		// Первые OpenLines строк зависят от предыдущих чанков
+		{"range, only in closed variant", models.Result{Matches: []models.Match{match(1)}, Range: &models.RangeState{OpenLines: 2}}, false},
+		{"range, after open lines", models.Result{Matches: []models.Match{match(3)}, Range: &models.RangeState{OpenLines: 2}}, true},
+		{"range, in both variants", models.Result{Matches: []models.Match{match(1)}, Range: &models.RangeState{OpenLines: 2, OpenMatches: []models.Match{match(2)}}}, true},
+	}
+	for _, tt := range tests {
+		if got := hasSelected(tt.result); got != tt.want {
+			t.Errorf("%s: hasSelected = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
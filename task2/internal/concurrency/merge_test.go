@@ -0,0 +1,358 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// formatMatches - строки результата в виде, удобном для сравнения и вывода в ошибке
+func formatMatches(matches []models.Match) []string {
+	lines := make([]string, 0, len(matches))
+	for _, m := range matches {
+		line := fmt.Sprintf("%d@%d %v %q", m.LineNumber, m.ByteOffset, m.Kind, m.Line)
+		for _, sub := range m.Submatches {
+			line += fmt.Sprintf(" [%d,%d)", sub.Start, sub.End)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// checkChunked - результат поиска по data чанками каждого размера из chunkSizes
+// должен совпадать с последовательным поиском (-Q 0) по всему файлу
+func checkChunked(t *testing.T, data string, chunkSizes []string, args ...string) {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatalf("parse %q: %v", args, err)
+	}
+	want, err := grep.Search(context.Background(), strings.NewReader(data), *fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.TailMode() {
+		want = grep.Tail(want, *fs)
+	}
+	wantLines := strings.Join(formatMatches(want.Matches), "\n")
+
+	path := writeFile(t, t.TempDir(), "data", data)
+	for _, size := range chunkSizes {
+		files := runMaster(t, 3, []string{path}, append([]string{"--chunk-size", size}, args...)...).MergeFiles()
+		if len(files) != 1 || files[0].Error != nil {
+			t.Fatalf("%q, chunk size %s: merged %+v", args, size, files)
+		}
+		got := files[0]
+		if fs.TailMode() {
+			// Как и при выводе, последние строки выбираются после сборки файла
+			got = grep.Tail(got, *fs)
+		}
+		if gotLines := strings.Join(formatMatches(got.Matches), "\n"); gotLines != wantLines {
+			t.Errorf("%q, chunk size %s:\n%s\nwant (-Q 0):\n%s", args, size, gotLines, wantLines)
+		}
+		if !fs.TailMode() && files[0].LineCount != want.LineCount {
+			t.Errorf("%q, chunk size %s: %d lines, want %d", args, size, files[0].LineCount, want.LineCount)
+		}
+	}
+}
+
+// numberedLines - n строк вида "line N", каждая every-я строка помечена словом mark
+func numberedLines(n, every int, mark string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d", i)
+		if i%every == 0 {
+			b.WriteString(" " + mark)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestMultilineChunkedMatchesSequential(t *testing.T) {
+	data := numberedLines(400, 9, "BEGIN") + "tail BEGIN\nlast"
+	sizes := []string{"64", "100", "257", "4K"}
+
+	// Вхождения на две строки, многие из них пересекают границы чанков
+	checkChunked(t, data, sizes, "-U", `BEGIN\nline \d+`)
+	checkChunked(t, data, sizes, "-U", "-n", `\d\nline 1\d`)
+	// . с --multiline-dotall захватывает перевод строки
+	checkChunked(t, data, sizes, "-U", "--multiline-dotall", `BEGIN.line \d+5`)
+	// ^ и $ - границы строк, в том числе последней строки без перевода
+	checkChunked(t, data, sizes, "-U", "-o", `^last$`)
+	checkChunked(t, data, sizes, "-U", "-c", `BEGIN\n`)
+}
+
+func TestMultilineMatchSpanningChunks(t *testing.T) {
+	// Вхождение длиной почти в чанк начинается в одном чанке и заканчивается в следующем
+	data := strings.Repeat("x\n", 20) + "start\n" + strings.Repeat("middle\n", 5) + "stop\n" + strings.Repeat("y\n", 20)
+	checkChunked(t, data, []string{"48", "64"}, "-U", "-n", `start\n(middle\n)+stop`)
+}
+
+func TestAppendMatchDeduplicates(t *testing.T) {
+	ctx := models.Match{LineNumber: 2, Kind: models.KindContext}
+	matched := models.Match{LineNumber: 2, Kind: models.KindMatch, Submatches: []models.Submatch{{Start: 0, End: 1}}}
+	other := models.Match{LineNumber: 2, Kind: models.KindMatch, Submatches: []models.Submatch{{Start: 3, End: 4}}}
+
+	var matches []models.Match
+	matches = appendMatch(matches, models.Match{LineNumber: 3, Kind: models.KindMatch})
+	matches = appendMatch(matches, ctx)
+	// Из перекрытия соседнего чанка та же строка приходит выбранной: она важнее контекста
+	matches = appendMatch(matches, matched)
+	matches = appendMatch(matches, other)
+	matches = appendMatch(matches, ctx)
+	matches = appendMatch(matches, models.Match{LineNumber: 1, Kind: models.KindContext})
+
+	got := formatMatches(matches)
+	want := []string{
+		`1@0 ` + fmt.Sprint(models.KindContext) + ` ""`,
+		`2@0 ` + fmt.Sprint(models.KindMatch) + ` "" [0,1) [3,4)`,
+		`3@0 ` + fmt.Sprint(models.KindMatch) + ` ""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("appendMatch:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRangeChunkedMatchesSequential(t *testing.T) {
+	// Блоки разной длины: внутри одного чанка, через границу и через несколько чанков
+	var b strings.Builder
+	for i, length := range []int{1, 3, 12, 40, 2, 90, 0} {
+		fmt.Fprintf(&b, "noise %d\nSTART %d\n", i, i)
+		for j := 0; j < length; j++ {
+			fmt.Fprintf(&b, "body %d.%d\n", i, j)
+		}
+		fmt.Fprintf(&b, "END %d\n", i)
+	}
+	b.WriteString("START unterminated\nbody\nbody\n")
+	data := b.String()
+	sizes := []string{"32", "64", "200", "1K", "64K"}
+
+	checkChunked(t, data, sizes, "-n", "--from", "START", "--to", "END")
+	checkChunked(t, data, sizes, "--from", "START", "--to", "END", "--exclude-from", "--exclude-to")
+	checkChunked(t, data, sizes, "-v", "--from", "START", "--to", "END")
+	checkChunked(t, data, sizes, "-c", "--from", "START")
+	// Контекст строк вне блока берётся из соседних чанков
+	checkChunked(t, data, sizes, "-n", "-C2", "--from", "START", "--to", "END", "--exclude-to")
+	checkChunked(t, data, sizes, "-o", "--from", "START [35]", "--to", "END")
+}
+
+func TestCSVChunkedMatchesSequential(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("id,name,comment\n")
+	for i := 1; i <= 120; i++ {
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&b, "%d,\"user, %d\",\"first line\nsecond line %d\nthird\"\n", i, i, i)
+		case 1:
+			fmt.Fprintf(&b, "%d,user%d,\"said \"\"ok %d\"\"\"\n", i, i, i)
+		default:
+			fmt.Fprintf(&b, "%d,user%d,plain %d\n", i, i, i)
+		}
+	}
+	data := b.String()
+	sizes := []string{"16", "50", "333", "2K"}
+
+	// Границы чанков не попадают внутрь полей в кавычках: записи и номера строк совпадают
+	checkChunked(t, data, sizes, "-n", "--csv", "--field", "3", "second line 1")
+	checkChunked(t, data, sizes, "--csv", "--field", "2", "-o", `user, \d+7`)
+	checkChunked(t, data, sizes, "-n", "--csv", "--field", "3", `"ok \d+"`)
+	checkChunked(t, data, sizes, "-c", "--csv", "-v", "--field", "3", "line")
+	checkChunked(t, data, sizes, "--csv", "--field", "2", "--print-fields", "user, 1")
+}
+
+// checkChunkedRegion - поиск чанками с ограничением области scopeArgs должен совпадать
+// с последовательным поиском по строкам data[start:end] с абсолютными номерами и смещениями
+func checkChunkedRegion(t *testing.T, data string, start, end int, scopeArgs []string, args ...string) {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := grep.Search(context.Background(), strings.NewReader(data[start:end]), *fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linesBefore := strings.Count(data[:start], "\n")
+	for i := range want.Matches {
+		want.Matches[i].LineNumber += linesBefore
+		want.Matches[i].ByteOffset += int64(start)
+	}
+	wantLines := strings.Join(formatMatches(want.Matches), "\n")
+
+	path := writeFile(t, t.TempDir(), "log", data)
+	for _, size := range []string{"4K", "64K"} {
+		flags := append(append([]string{"--chunk-size", size}, scopeArgs...), args...)
+		files := runMaster(t, 3, []string{path}, flags...).MergeFiles()
+		if len(files) != 1 || files[0].Error != nil {
+			t.Fatalf("%q: merged %+v", flags, files)
+		}
+		if got := strings.Join(formatMatches(files[0].Matches), "\n"); got != wantLines {
+			t.Errorf("%q:\n%s\nwant:\n%s", flags, got, wantLines)
+		}
+	}
+}
+
+func TestTimeRangeChunked(t *testing.T) {
+	var b strings.Builder
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 6000; i++ {
+		fmt.Fprintf(&b, "%s req %d status=%d\n", start.Add(time.Duration(i)*time.Second).Format("2006-01-02 15:04:05"), i, 200+i%7)
+		if i%50 == 0 {
+			b.WriteString("    stack status=500\n")
+		}
+	}
+	data := b.String()
+	first := strings.Index(data, "2024-05-01 10:20:00")
+	last := strings.Index(data, "2024-05-01 11:00:01")
+	checkChunkedRegion(t, data, first, last, []string{"--since", "2024-05-01T10:20:00", "--until", "2024-05-01T11:00:00"}, "-n", "-C1", "status=50")
+}
+
+func TestLineAndByteRangeChunked(t *testing.T) {
+	data := numberedLines(5000, 13, "mark")
+	offsets := []int{0} // offsets[n-1] - начало строки n
+	for i := range data {
+		if data[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	lineStart := func(n int) int { return offsets[n-1] }
+
+	checkChunkedRegion(t, data, lineStart(1200), lineStart(3801), []string{"--lines", "1200:3800"}, "-n", "-C2", "mark")
+	checkChunkedRegion(t, data, 0, lineStart(101), []string{"--lines", ":100"}, "-n", "mark")
+	checkChunkedRegion(t, data, lineStart(4990), len(data), []string{"--lines", "4990:"}, "-n", "-c", "mark")
+	// --bytes берёт строки, начинающиеся в диапазоне
+	byteStart, byteEnd := lineStart(2000)+3, lineStart(2500)+1
+	checkChunkedRegion(t, data, lineStart(2001), lineStart(2501), []string{"--bytes", fmt.Sprintf("%d:%d", byteStart, byteEnd)}, "-n", "-B1", "mark")
+	// Ограничения пересекаются
+	checkChunkedRegion(t, data, lineStart(2001), lineStart(2201), []string{"--bytes", fmt.Sprintf("%d:", byteStart), "--lines", ":2200"}, "-n", "mark")
+}
+
+func TestReverseChunkedMatchesSequential(t *testing.T) {
+	data := numberedLines(3000, 17, "hit") + "last hit without newline"
+	sizes := []string{"64", "300", "4K"}
+
+	checkChunked(t, data, sizes, "-n", "--reverse", "hit")
+	checkChunked(t, data, sizes, "-n", "--reverse", "-C3", "hit")
+	// Чтение с конца останавливается, когда последние совпадения подтверждены
+	checkChunked(t, data, sizes, "-n", "--tail-matches", "5", "hit")
+	checkChunked(t, data, sizes, "-n", "--tail-matches", "1", "-B2", "line 29")
+	checkChunked(t, data, sizes, "-n", "--reverse", "--tail-matches", "40", "-A1", "hit")
+	checkChunked(t, data, sizes, "-n", "--tail-matches", "10000", "hit")
+	checkChunked(t, data, sizes, "-n", "--tail-matches", "3", "-v", "^line 1")
+}
+
+func TestContextChunkedMatchesSequential(t *testing.T) {
+	data := numberedLines(600, 23, "hit") + "hit at the end"
+	// Чанки от долей строки до нескольких килобайт: контекст может лежать в нескольких соседних чанках
+	sizes := []string{"1", "7", "16", "64", "250", "4K"}
+
+	checkChunked(t, data, sizes, "-n", "-A3", "hit")
+	checkChunked(t, data, sizes, "-n", "-B4", "hit")
+	checkChunked(t, data, sizes, "-n", "-C12", "hit")
+	// Пересекающийся контекст соседних вхождений
+	checkChunked(t, data, sizes, "-n", "-C30", "hit")
+	checkChunked(t, data, sizes, "-n", "-C2", "-v", "line")
+	checkChunked(t, data, sizes, "-n", "-A1", "-o", "hit")
+}
+
+func TestSmallFilesBatched(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	var want []string
+	for i := 0; i < 40; i++ {
+		data := numberedLines(i%5+1, 2, "hit")
+		path := writeFile(t, dir, fmt.Sprintf("f%02d", i), data)
+		paths = append(paths, path)
+
+		fs, _, err := options.Parse([]string{"-n", "-A1", "hit"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := grep.Search(context.Background(), strings.NewReader(data), *fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, fmt.Sprintf("%s %d %q", path, res.LineCount, formatMatches(res.Matches)))
+	}
+
+	// Маленькие файлы объединяются в общие задачи, но собираются по отдельности и по порядку
+	files := runMaster(t, 4, paths, "--chunk-size", "64", "-n", "-A1", "hit").MergeFiles()
+	var got []string
+	for _, res := range files {
+		if res.Error != nil {
+			t.Fatalf("%s: %v", res.FilePath, res.Error)
+		}
+		got = append(got, fmt.Sprintf("%s %d %q", res.FilePath, res.LineCount, formatMatches(res.Matches)))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("merged files:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMmapChunkedMatchesSequential(t *testing.T) {
+	data := numberedLines(2000, 11, "hit") + "START\nbody hit\nEND\nhit at the end"
+	sizes := []string{"64", "1K", "64K"}
+
+	// Воркеры ищут прямо по отображению файла: результат тот же, что у чтения
+	checkChunked(t, data, sizes, "--mmap", "-n", "hit")
+	checkChunked(t, data, sizes, "--mmap", "-n", "-C3", "-o", "hit")
+	checkChunked(t, data, sizes, "--mmap", "-c", "-v", "hit")
+	checkChunked(t, data, sizes, "--mmap", "-U", "-n", `hit\nline \d+`)
+	checkChunked(t, data, sizes, "--mmap", "-n", "--from", "START", "--to", "END")
+	checkChunked(t, data, sizes, "--mmap", "-n", "--tail-matches", "3", "hit")
+}
+
+// openFiles - число открытых дескрипторов процесса; -1, если его не узнать
+func openFiles() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	var paths, want []string
+	for i := 0; i < 30; i++ {
+		data := numberedLines(150+i, 7, "hit")
+		path := writeFile(t, dir, fmt.Sprintf("f%02d", i), data)
+		paths = append(paths, path)
+
+		fs, _, err := options.Parse([]string{"-n", "-C1", "hit"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := grep.Search(context.Background(), strings.NewReader(data), *fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, fmt.Sprintf("%s %q", path, formatMatches(res.Matches)))
+	}
+
+	// Файлов и чанков намного больше, чем можно открыть одновременно
+	before := openFiles()
+	files := runMaster(t, 6, paths, "--max-open", "2", "--chunk-size", "256", "-n", "-C1", "hit").MergeFiles()
+	var got []string
+	for _, res := range files {
+		if res.Error != nil {
+			t.Fatalf("%s: %v", res.FilePath, res.Error)
+		}
+		got = append(got, fmt.Sprintf("%s %q", res.FilePath, formatMatches(res.Matches)))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("merged files:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// После поиска все дескрипторы пула закрыты
+	if after := openFiles(); before >= 0 && after != before {
+		t.Errorf("%d descriptors open after search, %d before", after, before)
+	}
+}
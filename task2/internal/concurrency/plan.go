@@ -0,0 +1,179 @@
+package concurrency
+
+import (
+	"context"
+	"os"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
+)
+
+// splitter - разметка файлов на чанки с учётом области поиска и записей CSV
+type splitter struct {
+	scope    *scope.Scope
+	files    *chunks.FilePool // файлы открываются на время разметки
+	csv      bool             // --csv: не разрывать записи с переводами строк внутри кавычек
+	parallel int              // сколько файлов размечается одновременно
+	whole    bool             // файлы не делятся на чанки
+}
+
+// newSplitter - разметка для поиска с флагами flags и workersCount воркерами
+func newSplitter(flags *options.FlagStruct, searchScope *scope.Scope, files *chunks.FilePool, workersCount int) *splitter {
+	before, after := flags.ContextLines()
+	return &splitter{
+		scope:    searchScope,
+		files:    files,
+		csv:      *flags.CSVFlag,
+		parallel: max(1, workersCount),
+		// Запись CSV может занимать несколько строк, и контекст по записям на границе
+		// чанков не восстановить по крайним строкам: при -A, -B, -C файлы ищутся целиком
+		whole: *flags.CSVFlag && before+after > 0,
+	}
+}
+
+// totalSize - общий размер файлов (для выбора размера чанков); файлы не открываются
+func totalSize(paths []string) int64 {
+	var total int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// filePlan - чанки одного файла с ID от нуля
+type filePlan struct {
+	path   string
+	chunks []chunks.Chunk
+	err    error
+}
+
+// planFiles - размечает файлы на чанки параллельно, одновременно не больше parallel
+// файлов. Границы ищутся через ReadAt, поэтому разметка не мешает воркерам,
+// уже читающим те же файлы. Планы приходят в каналы в порядке paths
+func (s *splitter) planFiles(ctx context.Context, paths []string, chunkSize int64) []chan filePlan {
+	plans := make([]chan filePlan, len(paths))
+	for i := range plans {
+		plans[i] = make(chan filePlan, 1)
+	}
+
+	go func() {
+		sem := make(chan struct{}, s.parallel)
+		for i, path := range paths {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(plan chan<- filePlan, path string) {
+				defer func() { <-sem }()
+				// log.Printf("Splitting file: %s", path)
+				fileChunks, err := s.splitPath(path, chunkSize)
+				plan <- filePlan{path: path, chunks: fileChunks, err: err}
+			}(plans[i], path)
+		}
+	}()
+	return plans
+}
+
+// splitPath - открывает файл из пула только на время разметки
+func (s *splitter) splitPath(path string, chunkSize int64) ([]chunks.Chunk, error) {
+	file, release, err := s.files.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	fileChunks, _, err := s.splitFile(file, 0, chunkSize)
+	return fileChunks, err
+}
+
+// splitFile - разбивает файл на чанки; если область поиска ограничена (--since, --until),
+// чанки строятся только для неё
+func (s *splitter) splitFile(file *os.File, lastChunkID int, chunkSize int64) ([]chunks.Chunk, int, error) {
+	if s.whole {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, lastChunkID, err
+		}
+		chunkSize = max(chunkSize, info.Size())
+	}
+	if !s.scope.Active() {
+		return chunks.SplitFiles([]*os.File{file}, lastChunkID, chunkSize, s.csv)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, lastChunkID, err
+	}
+	region, err := s.scope.Resolve(file, info.Size())
+	if err != nil {
+		return nil, lastChunkID, err
+	}
+	fileChunks, count, err := chunks.SplitRange(file, lastChunkID, region.Start, region.End, info.Size(), chunkSize, s.csv)
+	if err != nil {
+		return nil, lastChunkID, err
+	}
+	if count == 0 {
+		// Пустая область: файл всё равно попадает в результат (например, для -c)
+		fileChunks = append(fileChunks, chunks.Chunk{
+			FilePath:    file.Name(),
+			StartOffset: region.Start,
+			EndOffset:   region.Start,
+			ChunkID:     lastChunkID,
+			TotalChunks: 1,
+			FileSize:    info.Size(),
+			Fingerprint: chunks.NewFingerprint(info),
+		})
+		count = 1
+	}
+	fileChunks[0].LinesBefore = region.LinesBefore
+	return fileChunks, lastChunkID + count, nil
+}
+
+// PlanFiles - план поиска по файлам для команды plan: те же чанки, что построил бы
+// мастер с workersCount воркерами, с отпечатками файлов и номерами первых строк
+func PlanFiles(workersCount int, flags *options.FlagStruct, searchScope *scope.Scope, paths []string) (chunks.Manifest, error) {
+	planner, err := chunks.NewPlanner(*flags.ChunkSizeFlag, workersCount)
+	if err != nil {
+		return chunks.Manifest{}, err
+	}
+	files := chunks.NewFilePool(*flags.MaxOpenFlag)
+	defer files.Close()
+	s := newSplitter(flags, searchScope, files, workersCount)
+	manifest := chunks.Manifest{ChunkSize: planner.ChunkSize(totalSize(paths))}
+
+	for _, planned := range s.planFiles(context.Background(), paths, manifest.ChunkSize) {
+		plan := <-planned
+		if plan.err != nil {
+			return manifest, plan.err
+		}
+		fingerprint, err := s.numberChunks(plan)
+		if err != nil {
+			return manifest, err
+		}
+
+		for i := range plan.chunks {
+			plan.chunks[i].ChunkID += len(manifest.Chunks)
+			plan.chunks[i].FileIndex = len(manifest.Files)
+		}
+		manifest.Files = append(manifest.Files, chunks.PlannedFile{Path: plan.path, Fingerprint: fingerprint})
+		manifest.Chunks = append(manifest.Chunks, plan.chunks...)
+	}
+	return manifest, nil
+}
+
+// numberChunks - номера первых строк чанков файла и его отпечаток для плана
+func (s *splitter) numberChunks(plan filePlan) (chunks.Fingerprint, error) {
+	file, release, err := s.files.Open(plan.path)
+	if err != nil {
+		return chunks.Fingerprint{}, err
+	}
+	defer release()
+	info, err := file.Stat()
+	if err != nil {
+		return chunks.Fingerprint{}, err
+	}
+	return chunks.NewFingerprint(info), chunks.NumberChunks(file, plan.chunks)
+}
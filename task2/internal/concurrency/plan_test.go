@@ -0,0 +1,257 @@
+package concurrency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
+)
+
+func TestPlanFilesKeepsOrder(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 12; i++ {
+		// Сначала большие файлы: их разметка дольше, но планы всё равно идут по порядку
+		paths = append(paths, writeFile(t, dir, fmt.Sprintf("f%02d", i), strings.Repeat("some line\n", (12-i)*300)))
+	}
+	missing := filepath.Join(dir, "missing")
+	paths = append(paths[:5], append([]string{missing}, paths[5:]...)...)
+
+	fs, _, err := options.Parse([]string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchScope, err := scope.New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := chunks.NewFilePool(4)
+	defer files.Close()
+	split := newSplitter(fs, searchScope, files, 4)
+
+	for i, planned := range split.planFiles(context.Background(), paths, 1000) {
+		plan := <-planned
+		if plan.path != paths[i] {
+			t.Fatalf("plan %d is for %s, want %s", i, plan.path, paths[i])
+		}
+		if paths[i] == missing {
+			if plan.err == nil {
+				t.Error("missing file planned without an error")
+			}
+			continue
+		}
+		if plan.err != nil {
+			t.Fatalf("%s: %v", plan.path, plan.err)
+		}
+		// ID чанков каждого файла - от нуля, чанки покрывают файл целиком
+		var offset int64
+		for j, chunk := range plan.chunks {
+			if chunk.ChunkID != j || chunk.StartOffset != offset {
+				t.Fatalf("%s: chunk %d = %+v", plan.path, j, chunk)
+			}
+			offset = chunk.EndOffset
+		}
+		if offset != plan.chunks[0].FileSize {
+			t.Errorf("%s: chunks end at %d of %d", plan.path, offset, plan.chunks[0].FileSize)
+		}
+	}
+}
+
+// searchChunks - ищет по чанкам плана, как --plan-in: ID чанков нумеруются по порядку
+func searchChunks(t *testing.T, planChunks []chunks.Chunk, args ...string) []models.FileResult {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchScope, err := scope.New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := NewMaster(3, fs, searchScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	planChunks = append([]chunks.Chunk(nil), planChunks...)
+	for i := range planChunks {
+		planChunks[i].ChunkID = i
+	}
+	if err := master.ProcessChunks(planChunks, models.OperationGrep, fs.Pattern); err != nil {
+		t.Fatal(err)
+	}
+	return master.MergeFiles()
+}
+
+func TestPlanSearchMatchesDirectSearch(t *testing.T) {
+	dir := t.TempDir()
+	big := numberedLines(2000, 11, "hit")
+	paths := []string{
+		writeFile(t, dir, "big", big),
+		writeFile(t, dir, "small", "hit\nmiss\n"),
+		writeFile(t, dir, "other", numberedLines(500, 7, "hit")),
+	}
+	args := []string{"--chunk-size", "2K", "-n", "-C2", "hit"}
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchScope, err := scope.New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := PlanFiles(3, fs, searchScope, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// План проходит через JSON, как между командами plan и --plan-in
+	var buf bytes.Buffer
+	if err := chunks.WriteManifest(&buf, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest, err = chunks.ReadManifest(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	direct := runMaster(t, 3, paths, args...).MergeFiles()
+	planned := searchChunks(t, manifest.Chunks, args[2:]...)
+	if len(planned) != len(direct) {
+		t.Fatalf("plan search merged %d files, direct %d", len(planned), len(direct))
+	}
+	for i := range direct {
+		got, want := formatMatches(planned[i].Matches), formatMatches(direct[i].Matches)
+		if planned[i].FilePath != direct[i].FilePath || strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: plan search differs from direct search", direct[i].FilePath)
+		}
+	}
+
+	// Часть плана: номера строк абсолютные, выбраны только строки из своих чанков
+	var part []chunks.Chunk
+	for _, chunk := range manifest.Chunks {
+		if chunk.FilePath == paths[0] && chunk.ChunkID%2 == 1 {
+			part = append(part, chunk)
+		}
+	}
+	var want []string
+	for _, chunk := range part {
+		first, last := chunk.LinesBefore+1, chunk.LinesBefore+strings.Count(big[chunk.StartOffset:chunk.EndOffset], "\n")
+		for n := first; n <= last; n++ {
+			if n%11 == 0 {
+				want = append(want, fmt.Sprintf("line %d hit", n))
+			}
+		}
+	}
+	var got []string
+	for _, res := range searchChunks(t, part, "-n", "hit") {
+		for _, m := range res.Matches {
+			if string(m.Line) != fmt.Sprintf("line %d hit", m.LineNumber) {
+				t.Errorf("line %d is %q", m.LineNumber, m.Line)
+			}
+			got = append(got, string(m.Line))
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("part of the plan selected:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPlanOnChangePolicies(t *testing.T) {
+	original := numberedLines(300, 10, "hit")
+	tests := []struct {
+		name   string
+		change func(path string) error
+		policy string
+		hits   int // выбранных строк; -1 - файл завершается ошибкой
+		err    error
+	}{
+		{"appended, fail", appendLine, "fail", -1, chunks.ErrFileChanged},
+		{"rewritten, fail", rewriteInPlace, "fail", -1, chunks.ErrFileChanged},
+		// warn: чанки читаются в границах плана, но уже с новым содержимым
+		{"rewritten, warn", rewriteInPlace, "warn", 29, nil},
+		{"appended, warn", appendLine, "warn", 30, nil},
+		{"appended, snapshot", appendLine, "snapshot", 30, nil},
+		{"rewritten, snapshot", rewriteInPlace, "snapshot", -1, chunks.ErrFileRewritten},
+		{"truncated, snapshot", func(path string) error { return os.Truncate(path, 100) }, "snapshot", -1, chunks.ErrFileRewritten},
+	}
+	for _, tt := range tests {
+		path := writeFile(t, t.TempDir(), "log", original)
+		fs, _, err := options.Parse([]string{"--chunk-size", "1K", "hit"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchScope, err := scope.New(fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := PlanFiles(2, fs, searchScope, []string{path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.change(path); err != nil {
+			t.Fatal(err)
+		}
+
+		res := searchChunks(t, manifest.Chunks, "--on-change", tt.policy, "hit")
+		if len(res) != 1 {
+			t.Fatalf("%s: merged %d files", tt.name, len(res))
+		}
+		if tt.hits < 0 {
+			if !errors.Is(res[0].Error, tt.err) {
+				t.Errorf("%s: error %v, want %v", tt.name, res[0].Error, tt.err)
+			}
+			continue
+		}
+		if res[0].Error != nil || len(res[0].Matches) != tt.hits {
+			t.Errorf("%s: %d lines, error %v; want %d lines", tt.name, len(res[0].Matches), res[0].Error, tt.hits)
+		}
+	}
+}
+
+// appendLine - дописывает в файл строку с вхождением
+func appendLine(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString("appended hit\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rewriteInPlace - меняет одно вхождение, не меняя размер файла; время изменения
+// сдвигается явно, чтобы отпечаток отличался и на системах с грубыми отметками времени
+func rewriteInPlace(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteAt([]byte("HIT"), int64(bytes.Index(data, []byte("hit")))); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	mtime := info.ModTime().Add(time.Minute)
+	return os.Chtimes(path, mtime, mtime)
+}
@@ -0,0 +1,103 @@
+package concurrency
+
+import (
+	"fmt"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/rewrite"
+)
+
+// stitcher собирает переписанные воркерами чанки обратно в файлы.
+// Результаты приходят в произвольном порядке, а записываются строго по ChunkID:
+// чанки одного файла идут подряд, поэтому смена файла означает, что предыдущий готов
+type stitcher struct {
+	opts      rewrite.Options
+	pending   map[int]models.Result
+	nextChunk int
+	current   *rewrite.File
+	path      string
+	index     int  // номер текущего файла среди аргументов
+	started   bool // начата ли перезапись хотя бы одного файла
+	failed    bool // в текущем файле была ошибка, его нельзя заменять
+	errs      []error
+}
+
+func newStitcher(opts rewrite.Options) *stitcher {
+	return &stitcher{
+		opts:    opts,
+		pending: make(map[int]models.Result),
+	}
+}
+
+// add - принимает результат чанка и записывает все чанки, дошедшие до очереди
+func (s *stitcher) add(result models.Result) {
+	s.pending[result.ChunkID] = result
+	for {
+		next, ok := s.pending[s.nextChunk]
+		if !ok {
+			return
+		}
+		delete(s.pending, s.nextChunk)
+		s.nextChunk++
+		s.write(next)
+	}
+}
+
+func (s *stitcher) write(result models.Result) {
+	if !s.started || s.index != result.FileIndex {
+		s.commit()
+		s.started = true
+		s.path = result.FilePath
+		s.index = result.FileIndex
+		s.failed = false
+		file, err := rewrite.Create(result.FilePath, s.opts)
+		if err != nil {
+			// Остальные чанки файла пропускаются: без первых частей собирать его нельзя
+			s.fail(err)
+			return
+		}
+		s.current = file
+	}
+	if s.failed {
+		return
+	}
+	if result.Error != nil {
+		s.fail(result.Error)
+		return
+	}
+	if err := s.current.Write(result.Data, result.Matches, result.LineCount); err != nil {
+		s.fail(err)
+	}
+}
+
+// commit - завершает перезапись текущего файла
+func (s *stitcher) commit() {
+	if s.current == nil {
+		return
+	}
+	if !s.failed {
+		if err := s.current.Commit(); err != nil {
+			s.errs = append(s.errs, fmt.Errorf("%s: %v", s.path, err))
+		}
+	}
+	s.current = nil
+}
+
+// fail - помечает текущий файл как неудавшийся: временный файл удаляется, исходный не трогается
+func (s *stitcher) fail(err error) {
+	s.errs = append(s.errs, fmt.Errorf("%s: %v", s.path, err))
+	s.failed = true
+	if s.current != nil {
+		s.current.Abort()
+	}
+}
+
+// close - завершает последний файл и возвращает накопленные ошибки
+func (s *stitcher) close() []error {
+	if len(s.pending) > 0 {
+		// Какой-то чанк так и не пришёл: файл с пропуском собирать нельзя
+		s.fail(fmt.Errorf("missing result for chunk %d", s.nextChunk))
+	}
+	s.commit()
+	return s.errs
+}
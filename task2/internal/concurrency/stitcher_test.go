@@ -0,0 +1,152 @@
+package concurrency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/rewrite"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
+)
+
+// chunkResult - переписанный чанк chunkID файла path; changed - есть ли в нём изменения
+func chunkResult(path string, fileIndex, chunkID int, data string, changed bool) models.Result {
+	res := models.Result{FilePath: path, FileIndex: fileIndex, ChunkID: chunkID, Data: []byte(data), LineCount: strings.Count(data, "\n")}
+	if changed {
+		res.Matches = []models.Match{{LineNumber: 1, Kind: models.KindMatch}}
+	}
+	return res
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStitcherOrdersChunks(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a", "old\n")
+	b := writeFile(t, dir, "b", "old\n")
+
+	s := newStitcher(rewrite.Options{})
+	// Чанки приходят вперемешку, в том числе второй файл раньше первого
+	for _, res := range []models.Result{
+		chunkResult(b, 1, 3, "b2\n", true),
+		chunkResult(a, 0, 1, "a1\n", false),
+		chunkResult(b, 1, 2, "b1\n", false),
+		chunkResult(a, 0, 0, "a0\n", true),
+	} {
+		s.add(res)
+	}
+	if errs := s.close(); len(errs) != 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	if got := readFile(t, a); got != "a0\na1\n" {
+		t.Errorf("a = %q", got)
+	}
+	if got := readFile(t, b); got != "b1\nb2\n" {
+		t.Errorf("b = %q", got)
+	}
+}
+
+func TestStitcherFailedChunkKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a", "old a\n")
+	b := writeFile(t, dir, "b", "old b\n")
+
+	s := newStitcher(rewrite.Options{})
+	bad := chunkResult(a, 0, 1, "", false)
+	bad.Error = errors.New("read failed")
+	s.add(chunkResult(a, 0, 0, "new a\n", true))
+	s.add(bad)
+	s.add(chunkResult(a, 0, 2, "tail\n", true))
+	s.add(chunkResult(b, 1, 3, "new b\n", true))
+
+	errs := s.close()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "read failed") {
+		t.Fatalf("errors = %v, want one read error", errs)
+	}
+	// Файл с ошибкой остаётся нетронутым, следующий файл переписывается
+	if got := readFile(t, a); got != "old a\n" {
+		t.Errorf("a = %q", got)
+	}
+	if got := readFile(t, b); got != "new b\n" {
+		t.Errorf("b = %q", got)
+	}
+}
+
+func TestStitcherMissingChunk(t *testing.T) {
+	a := writeFile(t, t.TempDir(), "a", "old\n")
+
+	s := newStitcher(rewrite.Options{})
+	s.add(chunkResult(a, 0, 0, "new\n", true))
+	s.add(chunkResult(a, 0, 2, "new\n", true))
+
+	errs := s.close()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "missing result for chunk 1") {
+		t.Fatalf("errors = %v", errs)
+	}
+	if got := readFile(t, a); got != "old\n" {
+		t.Errorf("file with a missing chunk was replaced: %q", got)
+	}
+}
+
+func TestInPlaceChunkedMatchesSequential(t *testing.T) {
+	var data strings.Builder
+	for i := 0; i < 300; i++ {
+		switch i % 7 {
+		case 0:
+			data.WriteString("key=value key=other\n")
+		case 3:
+			data.WriteString("no match here\r\n")
+		default:
+			data.WriteString("line without it\n")
+		}
+	}
+	data.WriteString("key=last")
+	args := []string{"--in-place", "-r", "$1:", `(\w+)=`}
+
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _, err := grep.Replace(context.Background(), strings.NewReader(data.String()), *fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chunkSize := range []string{"64", "100", "1K"} {
+		path := writeFile(t, t.TempDir(), "f", data.String())
+		fs, _, err := options.Parse(append([]string{"--chunk-size", chunkSize}, args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchScope, err := scope.New(fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		master, err := NewMaster(3, fs, searchScope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := master.ProcessFilesStreaming([]string{path}, models.OperationReplace, fs.Pattern); err != nil {
+			t.Fatal(err)
+		}
+		if errs := master.RewriteErrors(); len(errs) != 0 {
+			t.Fatalf("chunk size %s: %v", chunkSize, errs)
+		}
+		if got := readFile(t, path); !bytes.Equal([]byte(got), want) {
+			t.Errorf("chunk size %s: chunked rewrite differs from sequential", chunkSize)
+		}
+	}
+}
@@ -1,30 +1,42 @@
 package concurrency
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"runtime/debug"
 	"sync"
 
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
 	"github.com/pozedorum/WB_project_4/task2/internal/grep"
 	"github.com/pozedorum/WB_project_4/task2/internal/models"
 	"github.com/pozedorum/WB_project_4/task2/internal/options"
 )
 
 type Worker struct {
+	ctx        context.Context
 	id         int
 	taskChan   <-chan models.Task
 	resultChan chan<- models.Result
 	flags      *options.FlagStruct
+	policy     chunks.ChangePolicy // --on-change: что делать с файлом, изменившимся после разметки
+	mappings   *chunks.Mappings    // --mmap: отображения файлов, общие для воркеров (nil - обычное чтение)
+	files      *chunks.FilePool    // открытые файлы, общие для воркеров
 	wg         *sync.WaitGroup
 }
 
-func newWorker(id int, wg *sync.WaitGroup, taskChan <-chan models.Task, resultChan chan<- models.Result, flags *options.FlagStruct) *Worker {
+func newWorker(ctx context.Context, id int, wg *sync.WaitGroup, taskChan <-chan models.Task, resultChan chan<- models.Result, flags *options.FlagStruct, policy chunks.ChangePolicy, mappings *chunks.Mappings, files *chunks.FilePool) *Worker {
 	w := &Worker{
+		ctx:        ctx,
 		id:         id,
 		taskChan:   taskChan,
 		resultChan: resultChan,
 		flags:      flags,
+		policy:     policy,
+		mappings:   mappings,
+		files:      files,
 		wg:         wg,
 	}
 	go w.run()
@@ -35,9 +47,12 @@ func (w *Worker) run() {
 	// log.Printf("Worker %d started", w.id)
 
 	for task := range w.taskChan {
-		result := w.processTask(task)
-		// fmt.Println("result uploaded", result.ChunkID)
-		w.resultChan <- result
+		// Задача может объединять чанки нескольких маленьких файлов: результат - по каждому
+		for _, chunk := range task.Parts() {
+			result := w.processTask(task, chunk)
+			// fmt.Println("result uploaded", result.ChunkID)
+			w.resultChan <- result
+		}
 	}
 
 	// log.Printf("Worker %d finished (task channel closed)", w.id)
@@ -46,62 +61,186 @@ func (w *Worker) run() {
 	w.wg.Done()
 }
 
-// processTask обрабатывает одну задачу
-func (w *Worker) processTask(task models.Task) models.Result {
+// processTask обрабатывает один чанк задачи
+func (w *Worker) processTask(task models.Task, chunk chunks.Chunk) models.Result {
 	// log.Printf("Worker %d processing task %d", w.id, task.ID)
 
-	var reader io.Reader
 	res := models.Result{
-		TaskID:   task.ID,
-		ChunkID:  task.Chunk.ChunkID,
-		WorkerID: w.id,
-		Lines:    nil,
-		Error:    nil,
-		FilePath: task.Chunk.FilePath, // Добавляем информацию о файле
+		TaskID:    task.ID,
+		ChunkID:   chunk.ChunkID,
+		WorkerID:  w.id,
+		Error:     nil,
+		FilePath:  chunk.FilePath, // Добавляем информацию о файле
+		FileIndex: chunk.FileIndex,
+	}
+
+	if err := w.ctx.Err(); err != nil {
+		// Обработка остановлена, задачу не выполняем
+		res.Error = err
+		return res
 	}
 
-	if task.Operation != models.OperationGrep {
+	if task.Operation != models.OperationGrep && task.Operation != models.OperationReplace {
 		res.Error = fmt.Errorf("operation is not supported")
 		return res
 	}
-	// fmt.Println("worker offsets: ", task.Chunk.StartOffset, task.Chunk.EndOffset)
-	reader, res.Error = task.Chunk.GetChunkReader()
+	// fmt.Println("worker offsets: ", chunk.StartOffset, chunk.EndOffset)
+	if w.mappings != nil {
+		data, changed, release, err := w.mappings.Acquire(chunk, w.policy)
+		if err == nil {
+			defer release()
+			res.Changed = changed
+			res.Error = w.processMapped(data, task, chunk, &res)
+			return res
+		}
+		if !errors.Is(err, chunks.ErrNotMappable) {
+			res.Error = err
+			return res
+		}
+		// Канал или специальный файл: читаем обычным образом
+	}
+
+	// Файл открывается только сейчас и возвращается в пул сразу после чанка
+	file, release, err := w.files.Open(chunk.FilePath)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	defer release()
+	if res.Changed, err = chunk.Check(file, w.policy); err != nil {
+		res.Error = err
+		return res
+	}
+
+	var reader io.Reader
+	var window *grep.Window
+	if *w.flags.MultilineFlag && task.Operation == models.OperationGrep {
+		// Многострочный поиск читает чанк с перекрытием соседних
+		var before int64
+		reader, before, res.Error = chunk.GetOverlapReader(file, task.Overlap)
+		window = &grep.Window{Start: before, End: before + chunk.GetChunkSize()}
+	} else {
+		reader = chunk.GetChunkReader(file)
+	}
 	if res.Error != nil {
 		res.Error = fmt.Errorf("failed to get chunk reader: %v", res.Error)
 		return res
 	}
 
 	// Обрабатываем данные
-	res.Lines, res.Error = w.processChunkGrep(reader)
-
-	// Закрываем reader если он реализует интерфейс Closer
-	if closer, ok := reader.(io.Closer); ok {
-		if err := closer.Close(); err != nil {
-			fmt.Printf("grep internal error: %v", err)
-		}
+	if task.Operation == models.OperationReplace {
+		res.Error = w.processChunkReplace(reader, chunk, &res)
+	} else {
+		res.Error = w.processChunkSearch(reader, chunk, window, &res)
 	}
-	// fmt.Println("worker end with: ", res.Lines)
 	return res
 }
 
-// processChunkGrep обрабатывает чанк с использованием пакета grep
-func (w *Worker) processChunkGrep(reader io.Reader) ([]string, error) {
-	var outputBuffer strings.Builder
+// processChunkSearch обрабатывает чанк и сохраняет структурированные совпадения в res
+func (w *Worker) processChunkSearch(reader io.Reader, chunk chunks.Chunk, window *grep.Window, res *models.Result) error {
+	found, err := grep.SearchWindow(w.ctx, reader, *w.flags, window)
+	if err != nil {
+		return fmt.Errorf("grep error: %v", err)
+	}
+	storeFound(found, chunk, res)
+	return nil
+}
+
+// processMapped обрабатывает чанк по отображению файла в память (--mmap): поиск идёт
+// прямо по байтам отображения, без чтения в буфер
+func (w *Worker) processMapped(data []byte, task models.Task, chunk chunks.Chunk, res *models.Result) (err error) {
+	// Если файл усекли после отображения, обращение к пропавшим страницам вызывает
+	// SIGBUS: превращаем его в ошибку чанка вместо аварийного завершения программы
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, fault := r.(interface{ Addr() uintptr }); !fault {
+				panic(r)
+			}
+			err = chunks.ErrFileRewritten
+		}
+	}()
+
+	// При --on-change=warn файл мог стать короче чанка: читаем, что осталось
+	end := min(chunk.EndOffset, int64(len(data)))
+	start := min(chunk.StartOffset, end)
+	if task.Operation == models.OperationReplace {
+		return w.processChunkReplace(bytes.NewReader(data[start:end]), chunk, res)
+	}
 
-	// Вызываем функцию grep
-	err := grep.Grep(reader, *w.flags, &outputBuffer)
+	readStart, readEnd := start, end
+	var window *grep.Window
+	if *w.flags.MultilineFlag {
+		// Многострочный поиск читает чанк с перекрытием соседних
+		if readStart, readEnd, err = chunk.OverlapBounds(bytes.NewReader(data), task.Overlap); err != nil {
+			return err
+		}
+		readEnd = min(readEnd, int64(len(data)))
+		window = &grep.Window{Start: start - readStart, End: end - readStart}
+	}
+
+	found, err := grep.SearchBytes(w.ctx, data[readStart:readEnd], *w.flags, window)
 	if err != nil {
-		return nil, fmt.Errorf("grep error: %v", err)
+		return fmt.Errorf("grep error: %v", err)
+	}
+	// Строки ссылаются на отображение, которое снимается после release
+	detachLines(found.Matches)
+	if found.Range != nil {
+		detachLines(found.Range.OpenMatches)
 	}
+	storeFound(found, chunk, res)
+	return nil
+}
 
-	if outputBuffer.Len() == 0 {
-		return []string{}, nil
+// detachLines - копирует строки из отображения файла в обычную память
+func detachLines(matches []models.Match) {
+	for i := range matches {
+		matches[i].Line = bytes.Clone(matches[i].Line)
+	}
+}
+
+// storeFound сохраняет в res найденное в чанке
+func storeFound(found models.FileResult, chunk chunks.Chunk, res *models.Result) {
+	// Смещения внутри чанка переводим в смещения от начала файла
+	for i := range found.Matches {
+		found.Matches[i].FilePath = chunk.FilePath
+		found.Matches[i].ByteOffset += chunk.StartOffset
+	}
+	for i := range found.Edges {
+		found.Edges[i].FilePath = chunk.FilePath
+		found.Edges[i].ByteOffset += chunk.StartOffset
+	}
+	if found.Range != nil {
+		for i := range found.Range.OpenMatches {
+			found.Range.OpenMatches[i].FilePath = chunk.FilePath
+			found.Range.OpenMatches[i].ByteOffset += chunk.StartOffset
+		}
+	}
+
+	res.Matches = found.Matches
+	res.Range = found.Range
+	res.Edges = found.Edges
+	res.LinesBefore = chunk.LinesBefore
+	res.LineCount = found.LineCount
+	res.ByteCount = found.ByteCount
+	res.Elapsed = found.Elapsed
+}
+
+// processChunkReplace переписывает чанк с заменами и сохраняет новое содержимое в res
+func (w *Worker) processChunkReplace(reader io.Reader, chunk chunks.Chunk, res *models.Result) error {
+	data, changed, err := grep.Replace(w.ctx, reader, *w.flags)
+	if err != nil {
+		return fmt.Errorf("replace error: %v", err)
 	}
 
-	output := strings.TrimSuffix(outputBuffer.String(), "\n")
-	if output == "" {
-		return []string{}, nil
+	for i := range changed.Matches {
+		changed.Matches[i].FilePath = chunk.FilePath
+		changed.Matches[i].ByteOffset += chunk.StartOffset
 	}
 
-	return strings.Split(output, "\n"), nil
+	res.Data = data
+	res.Matches = changed.Matches
+	res.LineCount = changed.LineCount
+	res.ByteCount = changed.ByteCount
+	return nil
 }
@@ -0,0 +1,290 @@
+// Package follow реализует --follow: после основного поиска файлы остаются под
+// наблюдением, как при tail -F. Дописанные полные строки просматриваются тем же
+// конвейером чанков и воркеров (при -Q 0 - последовательно), начиная со смещения,
+// до которого файл уже просмотрен. Подмена файла (новый inode, например после
+// ротации журнала) и усечение файла обнаруживаются при очередной проверке
+package follow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+	"github.com/pozedorum/WB_project_4/task2/internal/concurrency"
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
+)
+
+// Follower - наблюдение за файлами
+type Follower struct {
+	fs      *options.FlagStruct
+	scope   *scope.Scope
+	planner *chunks.Planner
+	master  *concurrency.Master // воркеры для дописанных частей при -Q N, общие для всех проверок
+	files   []*watchedFile
+	notices io.Writer // сообщения о подмене и усечении файлов
+}
+
+// watchedFile - файл под наблюдением
+type watchedFile struct {
+	path       string
+	file       *os.File    // nil, пока файла нет
+	info       os.FileInfo // сведения об открытом файле (для сравнения inode)
+	offset     int64       // до какого смещения файл просмотрен; всегда начало строки
+	lines      int         // строк до offset
+	linesKnown bool        // lines посчитано (нужно, только если выводятся номера строк)
+}
+
+// span - часть файла [start, end) для поиска
+type span struct {
+	watched     *watchedFile
+	file        *os.File
+	start       int64
+	end         int64
+	linesBefore int
+	current     bool // часть открытого сейчас файла, а не остаток подменённого
+}
+
+// New - открывает файлы и запоминает, где заканчивается последняя полная строка.
+// Основной поиск ограничивается этим местом (scope.Limit), дальше файлы
+// просматривает Run, поэтому ни одна строка не выводится дважды
+func New(fs *options.FlagStruct, paths []string, searchScope *scope.Scope, notices io.Writer) (*Follower, error) {
+	planner, err := chunks.NewPlanner(*fs.ChunkSizeFlag, *fs.ConcurrentMode)
+	if err != nil {
+		return nil, err
+	}
+	f := &Follower{fs: fs, scope: searchScope, planner: planner, notices: notices}
+	if *fs.ConcurrentMode > 0 {
+		if f.master, err = concurrency.NewMaster(*fs.ConcurrentMode, fs, searchScope); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range paths {
+		w := &watchedFile{path: path}
+		if err := w.open(); err == nil {
+			end, err := chunks.LineStartBefore(w.file, w.info.Size())
+			if err != nil {
+				fmt.Fprintf(notices, "grep: %v\n", err)
+			}
+			// Строки до этого места посчитает основной поиск, здесь - только при необходимости
+			w.offset, w.linesKnown = end, false
+			searchScope.Limit(path, end)
+		}
+		// Файл, которого пока нет, ждём: он будет просмотрен с начала, когда появится
+		f.files = append(f.files, w)
+	}
+	return f, nil
+}
+
+// Close - останавливает воркеров и закрывает файлы
+func (f *Follower) Close() {
+	if f.master != nil {
+		f.master.Close()
+	}
+	for _, w := range f.files {
+		w.close()
+	}
+}
+
+// Run - раз в --follow-interval проверяет файлы и передаёт emit результаты по
+// дописанным строкам (только файлы, где что-то выбрано). Работает до отмены ctx;
+// при -q возвращает true, как только найдена выбранная строка
+func (f *Follower) Run(ctx context.Context, emit func(models.FileResult) error) (bool, error) {
+	ticker := time.NewTicker(*f.fs.FollowInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+		}
+
+		var spans []span
+		var stale []*os.File // подменённые файлы, которые закрываются после поиска
+		for _, w := range f.files {
+			found, old := f.poll(w)
+			spans = append(spans, found...)
+			if old != nil {
+				stale = append(stale, old)
+			}
+		}
+
+		results, found, err := f.search(ctx, spans)
+		for _, file := range stale {
+			if err := file.Close(); err != nil {
+				fmt.Fprintf(f.notices, "grep: %v\n", err)
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		if found {
+			return true, nil
+		}
+		for _, res := range results {
+			if len(res.Matches) == 0 && res.Error == nil {
+				continue
+			}
+			if err := emit(res); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// poll - проверяет файл: новые полные строки, подмену и усечение. Возвращает
+// части для поиска и подменённый файл, если он был заменён новым
+func (f *Follower) poll(w *watchedFile) ([]span, *os.File) {
+	info, statErr := os.Stat(w.path)
+	if w.file == nil {
+		if statErr != nil || w.open() != nil {
+			return nil, nil
+		}
+		fmt.Fprintf(f.notices, "grep: %s: file appeared, following\n", w.path)
+	}
+	if f.fs.NeedLineNumbers() && !w.linesKnown {
+		// Номера строк продолжают нумерацию основного поиска
+		lines, err := chunks.CountLines(w.file, w.offset)
+		if err != nil {
+			fmt.Fprintf(f.notices, "grep: %v\n", err)
+			return nil, nil
+		}
+		w.lines, w.linesKnown = lines, true
+	}
+
+	var spans []span
+	var stale *os.File
+	if statErr == nil && !os.SameFile(info, w.info) {
+		// По пути лежит другой файл: дочитываем старый до конца (последняя строка
+		// может быть без перевода строки) и переходим к новому с начала
+		if old, err := w.file.Stat(); err == nil && old.Size() > w.offset {
+			spans = append(spans, span{watched: w, file: w.file, start: w.offset, end: old.Size(), linesBefore: w.lines})
+		}
+		stale = w.file
+		w.file = nil
+		fmt.Fprintf(f.notices, "grep: %s: file has been replaced, following the new file\n", w.path)
+		if w.open() != nil {
+			return spans, stale
+		}
+	}
+
+	current, err := w.file.Stat()
+	if err != nil {
+		return spans, stale
+	}
+	if current.Size() < w.offset {
+		fmt.Fprintf(f.notices, "grep: %s: file truncated\n", w.path)
+		w.offset, w.lines, w.linesKnown = 0, 0, true
+	}
+
+	end, err := chunks.LineStartBefore(w.file, current.Size())
+	if err != nil {
+		fmt.Fprintf(f.notices, "grep: %v\n", err)
+		return spans, stale
+	}
+	if end <= w.offset {
+		return spans, stale
+	}
+	spans = append(spans, span{watched: w, file: w.file, start: w.offset, end: end, linesBefore: w.lines, current: true})
+	w.offset = end
+	return spans, stale
+}
+
+// search - ищет по частям файлов. Части открытых файлов при -Q N обрабатывают
+// воркеры; остатки подменённых файлов читаются напрямую, так как по пути
+// воркеры открыли бы уже новый файл
+func (f *Follower) search(ctx context.Context, spans []span) ([]models.FileResult, bool, error) {
+	results := make([]models.FileResult, len(spans))
+	var totalSize int64
+	for _, sp := range spans {
+		totalSize += sp.end - sp.start
+	}
+	chunkSize := f.planner.ChunkSize(totalSize)
+	var fileChunks []chunks.Chunk
+
+	for i, sp := range spans {
+		if f.master == nil || !sp.current {
+			results[i] = f.searchSpan(ctx, sp)
+			if *f.fs.QuietFlag && len(results[i].Matches) > 0 {
+				return nil, true, nil
+			}
+			continue
+		}
+		spanChunks, _, err := chunks.SplitRange(sp.file, len(fileChunks), sp.start, sp.end, sp.end, chunkSize, *f.fs.CSVFlag)
+		if err != nil {
+			results[i] = models.FileResult{FilePath: sp.watched.path, Error: err}
+			continue
+		}
+		spanChunks[0].LinesBefore = sp.linesBefore
+		for j := range spanChunks {
+			spanChunks[j].FileIndex = i
+		}
+		fileChunks = append(fileChunks, spanChunks...)
+	}
+
+	if len(fileChunks) > 0 {
+		if err := f.master.ProcessChunks(fileChunks, models.OperationGrep, f.fs.Pattern); err != nil {
+			return nil, false, err
+		}
+		if f.master.Found() {
+			return nil, true, nil
+		}
+		// Чанки части помечены её индексом в spans; у результата потерянного чанка пути нет
+		for _, res := range f.master.MergeFiles() {
+			if res.FilePath != "" {
+				results[res.FileIndex] = res
+			}
+		}
+	}
+
+	for i, sp := range spans {
+		if sp.current && sp.watched.linesKnown {
+			sp.watched.lines = results[i].LineCount
+		}
+	}
+	return results, false, nil
+}
+
+// searchSpan - последовательный поиск по части файла; номера строк и смещения - от начала файла
+func (f *Follower) searchSpan(ctx context.Context, sp span) models.FileResult {
+	res, err := grep.Search(ctx, io.NewSectionReader(sp.file, sp.start, sp.end-sp.start), *f.fs)
+	res.Error = err
+	res.FilePath = sp.watched.path
+	for i := range res.Matches {
+		res.Matches[i].FilePath = sp.watched.path
+		res.Matches[i].LineNumber += sp.linesBefore
+		res.Matches[i].ByteOffset += sp.start
+	}
+	res.LineCount += sp.linesBefore
+	return res
+}
+
+// open - открывает файл по пути с начала
+func (w *watchedFile) open() error {
+	file, err := os.Open(w.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.info = file, info
+	w.offset, w.lines, w.linesKnown = 0, 0, true
+	return nil
+}
+
+// close - закрывает открытый файл
+func (w *watchedFile) close() {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
@@ -0,0 +1,163 @@
+package follow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/scope"
+)
+
+// newFollower - Follower для файлов paths с флагами args (шаблон - среди них)
+func newFollower(t *testing.T, paths []string, notices *bytes.Buffer, args ...string) *Follower {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatalf("parse %q: %v", args, err)
+	}
+	searchScope, err := scope.New(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(fs, paths, searchScope, notices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.Close)
+	return f
+}
+
+// check - одна проверка файлов, как в Run: выбранные строки в виде "имя:номер:строка"
+func check(t *testing.T, f *Follower) []string {
+	t.Helper()
+	var spans []span
+	for _, w := range f.files {
+		found, old := f.poll(w)
+		spans = append(spans, found...)
+		if old != nil {
+			defer old.Close()
+		}
+	}
+	results, _, err := f.search(context.Background(), spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, res := range results {
+		if res.Error != nil {
+			t.Fatalf("%s: %v", res.FilePath, res.Error)
+		}
+		for _, m := range res.Matches {
+			lines = append(lines, fmt.Sprintf("%s:%d:%s", filepath.Base(m.FilePath), m.LineNumber, m.Line))
+		}
+	}
+	return lines
+}
+
+// appendFile - дописывает data в конец файла path, создавая его при необходимости
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowRotateAndTruncate(t *testing.T) {
+	for _, workers := range []string{"0", "3"} {
+		t.Run("Q"+workers, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			appendFile(t, path, "hit 1\nskip\nhit part")
+
+			var notices bytes.Buffer
+			f := newFollower(t, []string{path}, &notices, "-Q", workers, "--chunk-size", "16", "-n", "hit")
+			// Незаконченную последнюю строку основной поиск не видит: её дочитает Follower
+			if w := f.files[0]; w.offset != int64(len("hit 1\nskip\n")) {
+				t.Fatalf("follow starts at %d", w.offset)
+			}
+			if got := check(t, f); got != nil {
+				t.Errorf("no complete new lines, got %q", got)
+			}
+
+			appendFile(t, path, "ial\nskip\nhit 4\nhit 5 unfinished")
+			want := []string{"app.log:3:hit partial", "app.log:5:hit 4"}
+			if got := check(t, f); !slices.Equal(got, want) {
+				t.Errorf("appended: %q, want %q", got, want)
+			}
+
+			// Ротация: старый файл дочитывается до конца, новый - с начала
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, path+".1", " tail")
+			appendFile(t, path, "skip\nhit new 2\n")
+			want = []string{"app.log:6:hit 5 unfinished tail", "app.log:2:hit new 2"}
+			if got := check(t, f); !slices.Equal(got, want) {
+				t.Errorf("rotated: %q, want %q", got, want)
+			}
+
+			// Усечение: файл снова просматривается с начала
+			if err := os.WriteFile(path, []byte("hit again\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			want = []string{"app.log:1:hit again"}
+			if got := check(t, f); !slices.Equal(got, want) {
+				t.Errorf("truncated: %q, want %q", got, want)
+			}
+			for _, notice := range []string{"has been replaced", "truncated"} {
+				if !strings.Contains(notices.String(), notice) {
+					t.Errorf("notices %q lack %q", notices.String(), notice)
+				}
+			}
+		})
+	}
+}
+
+func TestFollowMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "later.log")
+	var notices bytes.Buffer
+	f := newFollower(t, []string{path}, &notices, "-Q", "2", "-n", "hit")
+	if got := check(t, f); got != nil {
+		t.Errorf("missing file: %q", got)
+	}
+	appendFile(t, path, "hit first\n")
+	if got, want := check(t, f), []string{"later.log:1:hit first"}; !slices.Equal(got, want) {
+		t.Errorf("appeared: %q, want %q", got, want)
+	}
+	if !strings.Contains(notices.String(), "file appeared") {
+		t.Errorf("notices = %q", notices.String())
+	}
+}
+
+func TestRunQuietStopsOnMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "q.log")
+	appendFile(t, path, "old hit\n")
+	var notices bytes.Buffer
+	f := newFollower(t, []string{path}, &notices, "-Q", "2", "-q", "--follow-interval", "5ms", "hit")
+	appendFile(t, path, "skip\nnew hit\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	found, err := f.Run(ctx, func(res models.FileResult) error {
+		t.Errorf("-q emitted %+v", res)
+		return nil
+	})
+	if err != nil || !found {
+		t.Errorf("Run = %v, %v; want a match", found, err)
+	}
+}
@@ -0,0 +1,73 @@
+package grep
+
+import "testing"
+
+func TestHasUpper(t *testing.T) {
+	tests := []struct {
+		pattern string
+		literal bool
+		want    bool
+	}{
+		{"error", false, false},
+		{"Error", false, true},
+		{`\S+\W\D`, false, false}, // заглавные буквы экранирований - не литералы
+		{`\S+Ошибка`, false, true},
+		{`[A-Z]x`, false, false},
+		{`\S`, true, true}, // фиксированная строка проверяется целиком
+		{"σφάλμα", true, false},
+		{"Σφάλμα", true, true},
+	}
+	for _, tt := range tests {
+		if got := hasUpper(tt.pattern, tt.literal); got != tt.want {
+			t.Errorf("hasUpper(%q, %v) = %v, want %v", tt.pattern, tt.literal, got, tt.want)
+		}
+	}
+}
+
+func TestSmartCase(t *testing.T) {
+	input := "error\nERROR\nError\n"
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-S", "error"}, 3},
+		{[]string{"-S", "Error"}, 1},
+		{[]string{"-S", "-F", "error"}, 3},
+		{[]string{"-S", "-F", "ERROR"}, 1},
+		{[]string{"-S", `\w+OR`}, 1},
+		{[]string{"-i", "Error"}, 3},
+	}
+	for _, tt := range tests {
+		res := searchString(t, input, tt.args...)
+		if got := CountSelected(res.Matches); got != tt.want {
+			t.Errorf("%q: %d lines, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestFoldMatcherUnicode(t *testing.T) {
+	tests := []struct {
+		pattern string
+		line    string
+		want    [][2]int // вхождения в байтах
+	}{
+		{"привет", "ПРИВЕТ и Привет", [][2]int{{0, 12}, {16, 28}}},
+		// σ, ς и Σ - одна орбита простого свёртывания
+		{"όσος", "ΌΣΟΣ όσος", [][2]int{{0, 8}, {9, 17}}},
+		// Знак кельвина занимает три байта, k - один: границы берутся по строке
+		{"kelvin", "Kelvin", [][2]int{{0, 8}}},
+		{"straße", "STRASSE", nil}, // полное свёртывание (ß -> ss) не поддерживается
+	}
+	for _, tt := range tests {
+		subs := newFoldMatcher(tt.pattern).FindAll([]byte(tt.line))
+		if len(subs) != len(tt.want) {
+			t.Errorf("%q in %q: got %+v, want %v", tt.pattern, tt.line, subs, tt.want)
+			continue
+		}
+		for i, sub := range subs {
+			if sub.Start != tt.want[i][0] || sub.End != tt.want[i][1] {
+				t.Errorf("%q in %q: match %d = [%d, %d), want %v", tt.pattern, tt.line, i, sub.Start, sub.End, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package grep
+
+import (
+	"strings"
+	"testing"
+)
+
+// replacedLines - выбранные строки после подстановки --replace
+func replacedLines(t *testing.T, input string, args ...string) string {
+	t.Helper()
+	var lines []string
+	for _, m := range searchString(t, input, args...).Matches {
+		lines = append(lines, string(m.Replaced()))
+	}
+	return strings.Join(lines, "|")
+}
+
+func TestReplaceOutput(t *testing.T) {
+	input := "user=bob id=42\nno match\nuser=al id=7 user=cy id=8\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-r", "$2:$1", `user=(\w+) id=(\d+)`}, "42:bob|7:al 8:cy"},
+		{[]string{"-r", "${id}", `user=\w+ id=(?P<id>\d+)`}, "42|7 8"},
+		{[]string{"-r", "[$0]", `id=\d+`}, "user=bob [id=42]|user=al [id=7] user=cy [id=8]"},
+		// Пустая замена удаляет вхождения
+		{[]string{"-r", "", ` id=\d+`}, "user=bob|user=al user=cy"},
+		// Группа, не участвовавшая во вхождении, пустая
+		{[]string{"-r", "<$2>", `user=(\w+)(x)?`}, "<> id=42|<> id=7 <> id=8"},
+		// Без групп захвата ($0 доступен и для -F, и для приближённого поиска)
+		{[]string{"-F", "-r", "<$0>", "id="}, "user=bob <id=>42|user=al <id=>7 user=cy <id=>8"},
+		{[]string{"-F", "-i", "-r", "<$0>", "USER"}, "<user>=bob id=42|<user>=al id=7 <user>=cy id=8"},
+		{[]string{"--fuzzy", "1", "-r", "<$0>", "bob"}, "user=<bob> id=42"},
+	}
+	for _, tt := range tests {
+		if got := replacedLines(t, input, tt.args...); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceOnlyMatching(t *testing.T) {
+	res := searchString(t, "a1 b2\n", "-o", "-r", "$2$1", `([a-z])(\d)`)
+	if len(res.Matches) != 1 {
+		t.Fatalf("matches = %+v", res.Matches)
+	}
+	var got []string
+	for _, sub := range res.Matches[0].Submatches {
+		got = append(got, string(sub.Replacement))
+	}
+	if strings.Join(got, ",") != "1a,2b" {
+		t.Errorf("replacements = %q", got)
+	}
+}
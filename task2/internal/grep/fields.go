@@ -0,0 +1,308 @@
+package grep
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// fieldSpec - разбиение строк на поля (--delimiter, --csv) и выбор полей для поиска (--field)
+type fieldSpec struct {
+	delimiter string
+	csv       bool
+	ranges    []fieldRange // пусто - все поля
+	project   bool         // выводить только выбранные поля (--print-fields)
+}
+
+// fieldRange - диапазон номеров полей с 1 включительно; to == 0 - до последнего поля
+type fieldRange struct {
+	from int
+	to   int
+}
+
+// record - запись файла с разделителями: строка (при --csv может занимать
+// несколько строк файла) и её поля
+type record struct {
+	line   []byte
+	offset int64
+	number int // номер первой строки записи в файле
+	fields []field
+}
+
+// field - поле записи: декодированное значение и его сырой вид в строке
+type field struct {
+	value []byte
+	raw   []byte // сырые байты поля, включая кавычки CSV
+	start int    // смещение raw в строке записи
+}
+
+// newFieldSpec - разбирает флаги полей
+func newFieldSpec(fs options.FlagStruct) (*fieldSpec, error) {
+	spec := &fieldSpec{
+		delimiter: *fs.DelimiterFlag,
+		csv:       *fs.CSVFlag,
+		project:   *fs.PrintFieldsFlag,
+	}
+
+	switch {
+	case spec.delimiter == `\t`:
+		spec.delimiter = "\t"
+	case spec.delimiter == "" && spec.csv:
+		spec.delimiter = ","
+	case spec.delimiter == "":
+		spec.delimiter = "\t"
+	}
+	if spec.csv {
+		r, size := utf8.DecodeRuneInString(spec.delimiter)
+		if size != len(spec.delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return nil, fmt.Errorf("--csv requires a single-character delimiter, got %q", spec.delimiter)
+		}
+	}
+
+	if *fs.FieldFlag != "" {
+		for _, part := range strings.Split(*fs.FieldFlag, ",") {
+			rng, err := parseFieldRange(part)
+			if err != nil {
+				return nil, err
+			}
+			spec.ranges = append(spec.ranges, rng)
+		}
+	}
+	return spec, nil
+}
+
+// parseFieldRange - разбирает элемент списка --field: N, N-M или N-
+func parseFieldRange(part string) (fieldRange, error) {
+	from, to, isRange := strings.Cut(part, "-")
+	var rng fieldRange
+	var err error
+
+	if rng.from, err = strconv.Atoi(from); err != nil || rng.from < 1 {
+		return rng, fmt.Errorf("invalid field %q", part)
+	}
+	switch {
+	case !isRange:
+		rng.to = rng.from
+	case to != "":
+		if rng.to, err = strconv.Atoi(to); err != nil || rng.to < rng.from {
+			return rng, fmt.Errorf("invalid field range %q", part)
+		}
+	}
+	return rng, nil
+}
+
+// selected - участвует ли поле с индексом i (с 0) в поиске
+func (s *fieldSpec) selected(i int) bool {
+	if len(s.ranges) == 0 {
+		return true
+	}
+	for _, rng := range s.ranges {
+		if i+1 >= rng.from && (rng.to == 0 || i+1 <= rng.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRecords - разбивает данные на записи. lines и offsets - строки данных
+// из splitLines, по ним считаются номера строк записей
+func (s *fieldSpec) splitRecords(data []byte, lines [][]byte, offsets []int64) ([]record, error) {
+	if !s.csv {
+		records := make([]record, len(lines))
+		for i, line := range lines {
+			records[i] = record{line: line, offset: offsets[i], number: i + 1, fields: s.splitLine(line)}
+		}
+		return records, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma, _ = utf8.DecodeRuneInString(s.delimiter)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	var records []record
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %v", err)
+		}
+
+		// Границы записи и полей - по позициям, которые сообщает csv.Reader
+		end := reader.InputOffset()
+		for end > 0 && (data[end-1] == '\n' || data[end-1] == '\r') {
+			end--
+		}
+		line, col := reader.FieldPos(0)
+		start := offsets[line-1] + int64(col-1)
+		rec := record{line: data[start:end:end], offset: start, number: line}
+
+		for i, value := range values {
+			line, col := reader.FieldPos(i)
+			fieldStart := int(offsets[line-1] + int64(col-1) - start)
+			rec.fields = append(rec.fields, field{value: []byte(value), start: fieldStart})
+		}
+		commaLen := len(s.delimiter)
+		for i := range rec.fields {
+			fieldEnd := len(rec.line)
+			if i+1 < len(rec.fields) {
+				fieldEnd = rec.fields[i+1].start - commaLen
+			}
+			rec.fields[i].raw = rec.line[rec.fields[i].start:fieldEnd]
+		}
+		records = append(records, rec)
+	}
+}
+
+// splitLine - поля строки без кавычек
+func (s *fieldSpec) splitLine(line []byte) []field {
+	var fields []field
+	start := 0
+	for {
+		i := bytes.Index(line[start:], []byte(s.delimiter))
+		if i < 0 {
+			return append(fields, field{value: line[start:], raw: line[start:], start: start})
+		}
+		fields = append(fields, field{value: line[start : start+i], raw: line[start : start+i], start: start})
+		start += i + len(s.delimiter)
+	}
+}
+
+// projectFields - запись, состоящая только из выбранных полей (для --print-fields).
+// Значения CSV при необходимости снова заключаются в кавычки
+func (s *fieldSpec) projectFields(rec record) record {
+	var line []byte
+	var fields []field
+	for i, f := range rec.fields {
+		if !s.selected(i) {
+			continue
+		}
+		if len(fields) > 0 {
+			line = append(line, s.delimiter...)
+		}
+		start := len(line)
+		if s.csv && needsQuotes(f.value, s.delimiter) {
+			line = append(line, '"')
+			line = append(line, bytes.ReplaceAll(f.value, []byte{'"'}, []byte{'"', '"'})...)
+			line = append(line, '"')
+		} else {
+			line = append(line, f.value...)
+		}
+		fields = append(fields, field{value: f.value, start: start})
+	}
+
+	for i := range fields {
+		end := len(line)
+		if i+1 < len(fields) {
+			end = fields[i+1].start - len(s.delimiter)
+		}
+		fields[i].raw = line[fields[i].start:end]
+	}
+	rec.line = line
+	rec.fields = fields
+	return rec
+}
+
+// needsQuotes - нужно ли заключить значение CSV в кавычки
+func needsQuotes(value []byte, delimiter string) bool {
+	return bytes.Contains(value, []byte(delimiter)) || bytes.ContainsAny(value, "\"\r\n") ||
+		(len(value) > 0 && (value[0] == ' ' || value[0] == '\t'))
+}
+
+// matchRecord - есть ли вхождение шаблона хотя бы в одном из выбранных полей
+func (s *fieldSpec) matchRecord(matcher Matcher, rec record) bool {
+	for i, f := range rec.fields {
+		if s.selected(i) && matcher.Match(f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// findInRecord - вхождения шаблона в выбранных полях с позициями в строке записи
+func (s *fieldSpec) findInRecord(matcher Matcher, rec record) []models.Submatch {
+	var subs []models.Submatch
+	for i, f := range rec.fields {
+		if !s.selected(i) {
+			continue
+		}
+		for _, sub := range matcher.FindAll(f.value) {
+			sub.Start = f.rawIndex(sub.Start)
+			sub.End = f.rawIndex(sub.End)
+			for k, pos := range sub.Groups {
+				if pos >= 0 {
+					sub.Groups[k] = f.rawIndex(pos)
+				}
+			}
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// rawIndex - смещение в строке записи, соответствующее смещению i в значении поля.
+// В полях CSV в кавычках учитываются открывающая кавычка и удвоенные кавычки
+func (f field) rawIndex(i int) int {
+	if len(f.raw) == 0 || f.raw[0] != '"' {
+		return f.start + i
+	}
+	pos := 1
+	for k := 0; k < i && pos < len(f.raw); k++ {
+		switch {
+		case f.raw[pos] == '"' && pos+1 < len(f.raw) && f.raw[pos+1] == '"':
+			pos += 2
+		case f.raw[pos] == '\r' && f.value[k] == '\n':
+			// csv.Reader заменяет \r\n внутри кавычек на \n
+			pos += 2
+		default:
+			pos++
+		}
+	}
+	if pos > len(f.raw) {
+		pos = len(f.raw)
+	}
+	return f.start + pos
+}
+
+// selectFields - режим полей: выбирает записи, в выбранных полях которых есть вхождение
+// (или нет при -v). Возвращает записи, заменяющие строки при сборке результата
+func selectFields(matcher Matcher, spec *fieldSpec, data []byte, lines [][]byte, offsets []int64, fs options.FlagStruct) ([]record, []bool, func(j int) []models.Submatch, error) {
+	records, err := spec.splitRecords(data, lines, offsets)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if spec.project {
+		for i := range records {
+			records[i] = spec.projectFields(records[i])
+		}
+		// Поиск идёт уже по оставшимся полям
+		spec = &fieldSpec{delimiter: spec.delimiter, csv: spec.csv}
+	}
+
+	selected := make([]bool, len(records))
+	for i, rec := range records {
+		selected[i] = spec.matchRecord(matcher, rec) != *fs.VFlag
+	}
+
+	template := []byte(*fs.ReplaceFlag)
+	submatches := func(j int) []models.Submatch {
+		subs := spec.findInRecord(matcher, records[j])
+		if fs.ReplaceSet {
+			for k := range subs {
+				subs[k].Replacement = expand(matcher, template, records[j].line, subs[k])
+			}
+		}
+		return subs
+	}
+	return records, selected, submatches, nil
+}
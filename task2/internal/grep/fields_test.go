@@ -0,0 +1,112 @@
+package grep
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+func TestFieldSearch(t *testing.T) {
+	input := "a1\tb1\tc\nx\ty\tz1\n"
+	tests := []struct {
+		args []string
+		want string // выбранные строки через '|'
+	}{
+		{[]string{"1"}, "a1\tb1\tc|x\ty\tz1"},
+		{[]string{"--field", "2", "1"}, "a1\tb1\tc"},
+		{[]string{"--field", "3", "1"}, "x\ty\tz1"},
+		{[]string{"--field", "2-", "^[bz]"}, "a1\tb1\tc|x\ty\tz1"},
+		// Шаблон применяется к значению поля: ^ и $ - его границы
+		{[]string{"--field", "1,3", "^c$"}, "a1\tb1\tc"},
+		{[]string{"-v", "--field", "1", "x"}, "a1\tb1\tc"},
+		{[]string{"--field", "2", "--print-fields", "y"}, "y"},
+	}
+	for _, tt := range tests {
+		if got := joinLines(searchString(t, input, tt.args...)); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	res := searchString(t, "k=1;v=1\n", "--delimiter", ";", "--field", "2", "-o", "1")
+	if subs := res.Matches[0].Submatches; len(subs) != 1 || subs[0].Start != 6 || subs[0].End != 7 {
+		t.Errorf("submatches in field 2 = %+v, want [6, 7)", subs)
+	}
+}
+
+func TestCSVRecords(t *testing.T) {
+	input := "id,name,note\n" +
+		"1,\"Smith, J\",\"line one\nline two\"\n" +
+		"2,bob,\"say \"\"hi\"\"\"\n" +
+		"3,\"x\r\ny\",z\n"
+
+	// Запись в кавычках занимает несколько строк файла и выводится целиком с номером первой строки
+	res := searchString(t, input, "--csv", "--field", "3", "two")
+	if len(res.Matches) != 1 {
+		t.Fatalf("matches = %+v", res.Matches)
+	}
+	m := res.Matches[0]
+	if m.LineNumber != 2 || m.ByteOffset != 13 || string(m.Line) != "1,\"Smith, J\",\"line one\nline two\"" {
+		t.Errorf("record = %d@%d %q", m.LineNumber, m.ByteOffset, m.Line)
+	}
+	if len(m.Submatches) != 1 || m.Submatches[0].Start != 28 || m.Submatches[0].End != 31 {
+		t.Errorf("submatches = %+v, want [28, 31)", m.Submatches)
+	}
+	// Следующие записи нумеруются по строкам файла
+	if res.LineCount != 6 {
+		t.Errorf("line count = %d, want 6", res.LineCount)
+	}
+
+	// Разделитель внутри кавычек не делит поле
+	if got := joinLines(searchString(t, input, "--csv", "--field", "2", "^Smith, J$")); got != "1,\"Smith, J\",\"line one\nline two\"" {
+		t.Errorf("quoted delimiter: %q", got)
+	}
+	// Удвоенная кавычка в значении - одна кавычка; позиции вхождения - в сырой строке
+	res = searchString(t, input, "--csv", "--field", "3", `"hi"`)
+	if len(res.Matches) != 1 || res.Matches[0].LineNumber != 4 {
+		t.Fatalf("escaped quotes: %+v", res.Matches)
+	}
+	if subs := res.Matches[0].Submatches; len(subs) != 1 || subs[0].Start != 11 || subs[0].End != 17 {
+		t.Errorf("escaped quote submatches = %+v, want [11, 17)", subs)
+	}
+	// \r\n внутри кавычек
+	res = searchString(t, input, "--csv", "--field", "2", `x\ny`)
+	if len(res.Matches) != 1 || res.Matches[0].LineNumber != 5 {
+		t.Errorf("CRLF inside quotes: %+v", res.Matches)
+	}
+	if got := joinLines(searchString(t, input, "--csv", "--field", "3", "--print-fields", "hi")); got != `"say ""hi"""` {
+		t.Errorf("--print-fields re-quotes value: %q", got)
+	}
+}
+
+func TestFieldSpecErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--field", "0", "x"},
+		{"--field", "3-2", "x"},
+		{"--field", "a", "x"},
+		{"--csv", "--delimiter", "::", "x"},
+		{"--csv", "--delimiter", `"`, "x"},
+		{"--field", "1", "-U", "x"},
+		{"--field", "1", "--from", "x"},
+	} {
+		fs, _, err := options.Parse(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewMatcher(*fs); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+}
+
+// joinLines - выбранные строки результата через '|'
+func joinLines(res models.FileResult) string {
+	var lines []string
+	for _, m := range res.Matches {
+		if m.Kind == models.KindMatch {
+			lines = append(lines, string(m.Line))
+		}
+	}
+	return strings.Join(lines, "|")
+}
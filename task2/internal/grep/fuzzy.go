@@ -0,0 +1,191 @@
+package grep
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+)
+
+// maxFuzzyPattern - максимальная длина шаблона для --fuzzy (ширина битовой маски)
+const maxFuzzyPattern = 64
+
+// fuzzyMatcher - приближённый поиск фиксированной строки с не более чем k
+// вставками, удалениями или заменами (битово-параллельный алгоритм Wu-Manber, как в agrep)
+type fuzzyMatcher struct {
+	pattern    []rune
+	k          int
+	ignoreCase bool
+	ascii      [utf8.RuneSelf]uint64 // битовые маски позиций символа в шаблоне
+	masks      map[rune]uint64       // маски для остальных рун
+	last       uint64                // бит последнего символа шаблона
+}
+
+func newFuzzyMatcher(pattern string, k int, ignoreCase bool) (*fuzzyMatcher, error) {
+	runes := []rune(pattern)
+	if len(runes) == 0 {
+		return nil, fmt.Errorf("fuzzy pattern cannot be empty")
+	}
+	if len(runes) > maxFuzzyPattern {
+		return nil, fmt.Errorf("fuzzy pattern is too long: %d characters (max %d)", len(runes), maxFuzzyPattern)
+	}
+	if k >= len(runes) {
+		// Иначе с шаблоном совпадает любая строка
+		return nil, fmt.Errorf("fuzzy distance %d must be less than the pattern length %d", k, len(runes))
+	}
+
+	m := &fuzzyMatcher{
+		k:          k,
+		ignoreCase: ignoreCase,
+		masks:      make(map[rune]uint64),
+		last:       1 << (len(runes) - 1),
+	}
+	for i, r := range runes {
+		r = m.fold(r)
+		runes[i] = r
+		if r < utf8.RuneSelf {
+			m.ascii[r] |= 1 << i
+		} else {
+			m.masks[r] |= 1 << i
+		}
+	}
+	m.pattern = runes
+	return m, nil
+}
+
+func (m *fuzzyMatcher) fold(r rune) rune {
+	if m.ignoreCase {
+		return foldRune(r)
+	}
+	return r
+}
+
+func (m *fuzzyMatcher) mask(r rune) uint64 {
+	r = m.fold(r)
+	if r < utf8.RuneSelf {
+		return m.ascii[r]
+	}
+	return m.masks[r]
+}
+
+func (m *fuzzyMatcher) Match(line []byte) bool {
+	_, _, ok := m.next(line, 0)
+	return ok
+}
+
+func (m *fuzzyMatcher) FindAll(line []byte) []models.Submatch {
+	var subs []models.Submatch
+	for from := 0; from < len(line); {
+		end, dist, ok := m.next(line, from)
+		if !ok {
+			break
+		}
+		start, dist := m.bestStart(line, from, end, dist)
+		subs = append(subs, models.Submatch{Start: start, End: end, Distance: dist})
+		if end <= from {
+			break
+		}
+		from = end
+	}
+	return subs
+}
+
+// next - ищет, начиная с from, первую позицию конца вхождения с не более чем k ошибками.
+// Пока следующие символы не увеличивают число ошибок, конец сдвигается вправо.
+// Возвращает конец вхождения (в байтах) и число ошибок
+func (m *fuzzyMatcher) next(line []byte, from int) (int, int, bool) {
+	// state[d] - префиксы шаблона, совпавшие с не более чем d ошибками
+	state := make([]uint64, m.k+1)
+	for d := range state {
+		state[d] = 1<<d - 1
+	}
+
+	found, foundEnd, foundDist := false, 0, 0
+	for i := from; i < len(line); {
+		r, size := utf8.DecodeRune(line[i:])
+		i += size
+
+		mask := m.mask(r)
+		prev := state[0]
+		state[0] = ((state[0] << 1) | 1) & mask
+		for d := 1; d <= m.k; d++ {
+			old := state[d]
+			state[d] = ((old<<1)|1)&mask | // совпадение
+				prev | // лишний символ в тексте
+				(state[d-1] << 1) | 1 | // пропущенный символ шаблона
+				(prev << 1) // замена
+			prev = old
+		}
+
+		dist := -1
+		for d := 0; d <= m.k; d++ {
+			if state[d]&m.last != 0 {
+				dist = d
+				break
+			}
+		}
+		switch {
+		case dist >= 0 && (!found || dist <= foundDist):
+			found, foundEnd, foundDist = true, i, dist
+		case found:
+			// Дальше вхождение не улучшается
+			return foundEnd, foundDist, true
+		}
+		if found && foundDist == 0 {
+			return foundEnd, foundDist, true
+		}
+	}
+	return foundEnd, foundDist, found
+}
+
+// bestStart - находит начало вхождения, заканчивающегося в end, с минимальным
+// расстоянием редактирования (динамическое программирование справа налево)
+func (m *fuzzyMatcher) bestStart(line []byte, from, end, dist int) (int, int) {
+	// Руны окна, в котором может начинаться вхождение
+	var window []rune
+	var starts []int
+	for i := end; i > from && len(window) < len(m.pattern)+m.k; {
+		r, size := utf8.DecodeLastRune(line[from:i])
+		i -= size
+		window = append(window, m.fold(r))
+		starts = append(starts, i)
+	}
+
+	// prev[j] - расстояние между последними j символами шаблона и последними i символами окна
+	n := len(m.pattern)
+	prev := make([]int, n+1)
+	cur := make([]int, n+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	bestStart, bestDist := end, prev[n]
+	for i := 1; i <= len(window); i++ {
+		cur[0] = 0
+		for j := 1; j <= n; j++ {
+			cost := 1
+			if window[i-1] == m.pattern[n-j] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j-1]+cost, prev[j]+1, cur[j-1]+1)
+		}
+		if cur[n] < bestDist || (cur[n] == bestDist && i <= n) {
+			bestStart, bestDist = starts[i-1], cur[n]
+		}
+		prev, cur = cur, prev
+	}
+
+	if bestDist > dist {
+		bestDist = dist
+	}
+	return bestStart, bestDist
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
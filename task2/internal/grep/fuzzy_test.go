@@ -0,0 +1,101 @@
+package grep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFuzzyMatcher(t *testing.T) {
+	long := strings.Repeat("ab", 32) // 64 символа - вся ширина маски
+	tests := []struct {
+		name    string
+		pattern string
+		k       int
+		line    string
+		want    bool
+	}{
+		{"k0 exact", "hello", 0, "say hello world", true},
+		{"k0 substitution", "hello", 0, "say hallo world", false},
+		{"k0 deletion", "hello", 0, "say helo world", false},
+		{"k1 substitution", "hello", 1, "say hallo world", true},
+		{"k1 deletion", "hello", 1, "say helo world", true},
+		{"k1 insertion", "hello", 1, "say helllo world", true},
+		{"k1 two edits", "hello", 1, "say hxllx world", false},
+		{"k0 runes", "привет", 0, "всем привет", true},
+		{"k1 runes", "привет", 1, "всем превет", true},
+		{"64 runes exact", long, 0, "x" + long + "x", true},
+		{"64 runes last differs", long, 0, long[:63] + "c", false},
+		{"64 runes last substituted", long, 1, long[:63] + "c", true},
+		{"64 runes first missing", long, 1, long[1:], true},
+		{"64 runes two edits", long, 1, "c" + long[1:63] + "c", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newFuzzyMatcher(tt.pattern, tt.k, false)
+			if err != nil {
+				t.Fatalf("newFuzzyMatcher: %v", err)
+			}
+			if got := m.Match([]byte(tt.line)); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuzzyMatcherFindAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		k       int
+		line    string
+		want    []string
+		dists   []int
+	}{
+		{"k0", "cat", 0, "cat dog cat", []string{"cat", "cat"}, []int{0, 0}},
+		{"k0 no match", "cat", 0, "cut dog", nil, nil},
+		{"k1", "cat", 1, "cut dog cat", []string{"cut", "cat"}, []int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newFuzzyMatcher(tt.pattern, tt.k, false)
+			if err != nil {
+				t.Fatalf("newFuzzyMatcher: %v", err)
+			}
+			subs := m.FindAll([]byte(tt.line))
+			if len(subs) != len(tt.want) {
+				t.Fatalf("FindAll(%q) = %v, want %q", tt.line, subs, tt.want)
+			}
+			for i, sub := range subs {
+				if got := tt.line[sub.Start:sub.End]; got != tt.want[i] || sub.Distance != tt.dists[i] {
+					t.Errorf("match %d = %q (distance %d), want %q (distance %d)", i, got, sub.Distance, tt.want[i], tt.dists[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewFuzzyMatcherErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		k       int
+		wantErr bool
+	}{
+		{"63 runes", strings.Repeat("a", 63), 0, false},
+		{"64 runes", strings.Repeat("a", 64), 0, false},
+		{"64 cyrillic runes", strings.Repeat("я", 64), 2, false},
+		{"65 runes", strings.Repeat("a", 65), 0, true},
+		{"65 cyrillic runes", strings.Repeat("я", 65), 0, true},
+		{"empty", "", 0, true},
+		{"k equals length", "abc", 3, true},
+		{"k below length", "abc", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newFuzzyMatcher(tt.pattern, tt.k, false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newFuzzyMatcher(%d runes, %d) error = %v, wantErr %v", len([]rune(tt.pattern)), tt.k, err, tt.wantErr)
+			}
+		})
+	}
+}
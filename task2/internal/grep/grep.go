@@ -1,133 +1,402 @@
-// Package grep содержит функцию Grep и необходимые для её работы вспомогательные функции
+// Package grep содержит функцию Search и необходимые для её работы вспомогательные функции
 package grep
 
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"regexp"
+	"sort"
+	"time"
 
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
 	"github.com/pozedorum/WB_project_4/task2/internal/options"
 )
 
-// Grep выполняет поиск по шаблону в текстовом потоке с учетом флагов
-func Grep(input io.Reader, fs options.FlagStruct, writer io.Writer) error {
-	var re *regexp.Regexp
-	var err error
+// Search выполняет поиск по шаблону и возвращает выбранные и контекстные строки
+// в виде структурированных записей. Номера строк и смещения считаются от начала input.
+// При -q поиск прекращается на первой выбранной строке; отмена ctx прерывает чтение.
+func Search(ctx context.Context, input io.Reader, fs options.FlagStruct) (models.FileResult, error) {
+	return SearchWindow(ctx, input, fs, nil)
+}
+
+// Window - собственная область чанка внутри прочитанных данных (для -U):
+// байты до Start и после End - перекрытие с соседними чанками. Вхождения
+// учитываются, только если начинаются внутри [Start, End)
+type Window struct {
+	Start int64
+	End   int64
+}
 
-	if *fs.FFlag {
-		// Фиксированная строка - экранируем спецсимволы
-		fs.Pattern = regexp.QuoteMeta(fs.Pattern)
+// SearchWindow - то же, что Search, но в многострочном режиме ищет только
+// вхождения, начинающиеся в окне win (nil - весь input). Номера строк и смещения
+// считаются от начала окна
+func SearchWindow(ctx context.Context, input io.Reader, fs options.FlagStruct, win *Window) (models.FileResult, error) {
+	var res models.FileResult
+	started := time.Now()
+
+	matcher, err := NewMatcher(fs)
+	if err != nil {
+		return res, err
 	}
 
-	if *fs.IFlag {
-		// Игнорирование регистра
-		re, err = regexp.Compile("(?i)" + fs.Pattern)
-	} else {
-		re, err = regexp.Compile(fs.Pattern)
+	if *fs.QuietFlag && !*fs.MultilineFlag && !fs.RangeMode() && !fs.FieldMode() {
+		err = searchFirst(ctx, input, matcher, *fs.VFlag, &res)
+		res.Elapsed = time.Since(started)
+		return res, err
 	}
 
+	// Читаем все строки в память для обработки контекста
+	data, err := io.ReadAll(input)
 	if err != nil {
-		return fmt.Errorf("invalid fs.Pattern: %v", err)
+		return res, fmt.Errorf("error reading input: %v", err)
 	}
+	return searchData(data, matcher, fs, win, started)
+}
 
-	// Читаем все строки в память для обработки контекста
-	scanner := bufio.NewScanner(input)
-	lines := make([]string, 0)
-	lineNumbers := make([]int, 0)
-	lineIdx := 1
+// SearchBytes - то же, что SearchWindow, но по данным, уже находящимся в памяти
+// (например, отображённому в память файлу, --mmap): строки выделяются из data без
+// копирования, поэтому Line в результате ссылается на data
+func SearchBytes(ctx context.Context, data []byte, fs options.FlagStruct, win *Window) (models.FileResult, error) {
+	var res models.FileResult
+	started := time.Now()
+
+	matcher, err := NewMatcher(fs)
+	if err != nil {
+		return res, err
+	}
 
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-		lineNumbers = append(lineNumbers, lineIdx)
-		lineIdx++
+	if *fs.QuietFlag && !*fs.MultilineFlag && !fs.RangeMode() && !fs.FieldMode() {
+		err = searchFirst(ctx, bytes.NewReader(data), matcher, *fs.VFlag, &res)
+		res.Elapsed = time.Since(started)
+		return res, err
 	}
+	return searchData(data, matcher, fs, win, started)
+}
 
-	if err = scanner.Err(); err != nil {
-		return fmt.Errorf("error reading input: %v", err)
+// searchData - поиск по прочитанным данным (общая часть SearchWindow и SearchBytes)
+func searchData(data []byte, matcher Matcher, fs options.FlagStruct, win *Window, started time.Time) (models.FileResult, error) {
+	var res models.FileResult
+	if win == nil {
+		win = &Window{Start: 0, End: int64(len(data))}
 	}
+	lines, offsets := splitLines(data[win.Start:])
 
-	// Определяем, какие строки совпадают с шаблоном
-	matches := make([]bool, len(lines))
-	for i, line := range lines {
-		matches[i] = re.MatchString(line)
-		if *fs.VFlag {
-			matches[i] = !matches[i]
+	// Строки, начинающиеся в перекрытии после окна, не относятся к этому чанку
+	res.LineCount = len(lines)
+	for res.LineCount > 0 && offsets[res.LineCount-1] >= win.End-win.Start {
+		res.LineCount--
+	}
+	res.ByteCount = win.End - win.Start
+	if !*fs.CSVFlag {
+		res.Edges = edgeLines(lines[:res.LineCount], offsets, fs)
+	}
+
+	var selected []bool
+	var submatches func(j int) []models.Submatch
+	var numbers []int
+	switch {
+	case *fs.MultilineFlag:
+		selected, submatches = selectMultiline(matcher, data, *win, lines, offsets, fs)
+	case fs.RangeMode():
+		rs, err := newRangeSelector(fs)
+		if err != nil {
+			return res, err
+		}
+		var openSelected []bool
+		res.Range = &models.RangeState{}
+		selected, openSelected, res.Range.OpenLines, res.Range.EndOpen, res.Range.OpenEndOpen = selectRange(rs, lines, *fs.VFlag)
+		submatches = func(j int) []models.Submatch { return rs.submatches(lines[j]) }
+
+		// Вариант для блока, открытого в предыдущем чанке, нужен только для первых строк
+		// Выбор вариантов совпадает после OpenLines, вывод - ещё и после контекста -A этих строк
+		_, after := fs.ContextLines()
+		res.Range.OpenLines += after
+		for _, m := range collectMatches(lines, offsets, nil, openSelected, submatches, fs) {
+			if m.LineNumber <= res.Range.OpenLines {
+				res.Range.OpenMatches = append(res.Range.OpenMatches, m)
+			}
+		}
+	case fs.FieldMode():
+		spec, err := newFieldSpec(fs)
+		if err != nil {
+			return res, err
 		}
+		var records []record
+		records, selected, submatches, err = selectFields(matcher, spec, data, lines, offsets, fs)
+		if err != nil {
+			return res, err
+		}
+
+		// Дальше записи обрабатываются как строки; запись CSV может занимать несколько строк файла
+		lines = make([][]byte, len(records))
+		offsets = make([]int64, len(records))
+		numbers = make([]int, len(records))
+		for i, rec := range records {
+			lines[i], offsets[i], numbers[i] = rec.line, rec.offset, rec.number
+		}
+	default:
+		selected, submatches = selectLines(matcher, lines, fs)
 	}
 
-	// Если флаг -c, просто считаем совпадения
-	if *fs.SmallCFlag {
-		count := 0
-		for _, match := range matches {
-			if match {
-				count++
+	res.Matches = collectMatches(lines, offsets, numbers, selected, submatches, fs)
+
+	res.Elapsed = time.Since(started)
+	return res, nil
+}
+
+// collectMatches - собирает выбранные строки вместе с контекстом (-A, -B, -C).
+// numbers - номера строк в файле, если они не совпадают с порядковыми (nil - по порядку)
+func collectMatches(lines [][]byte, offsets []int64, numbers []int, selected []bool, submatches func(j int) []models.Submatch, fs options.FlagStruct) []models.Match {
+	before, after := fs.ContextLines()
+
+	var matches []models.Match
+	printed := make([]bool, len(lines))
+	for i, isMatch := range selected {
+		if !isMatch {
+			continue
+		}
+		start := max(0, i-before)
+		end := min(len(lines)-1, i+after)
+
+		for j := start; j <= end; j++ {
+			if printed[j] {
+				continue
+			}
+			m := models.Match{
+				LineNumber: j + 1,
+				ByteOffset: offsets[j],
+				Line:       lines[j],
+				Kind:       models.KindContext,
 			}
+			if numbers != nil {
+				m.LineNumber = numbers[j]
+			}
+			if selected[j] {
+				m.Kind = models.KindMatch
+				if !*fs.VFlag {
+					m.Submatches = submatches(j)
+				}
+			}
+			matches = append(matches, m)
+			printed[j] = true
 		}
-		if _, err := fmt.Fprintf(writer, "%d\n", count); err != nil {
-			// fmt.Printf("grep internal error: %v", err)
-			return err
+	}
+	return matches
+}
+
+// edgeLines - первые -A и последние -B строк фрагмента. Контекст выбранной строки,
+// не попавший в её чанк, лежит у края соседнего чанка: по этим строкам мастер
+// дополняет контекст при сборке файла (см. EdgeContext). Строки копируются: иначе
+// они держали бы в памяти весь буфер чанка, даже если в нём ничего не выбрано
+func edgeLines(lines [][]byte, offsets []int64, fs options.FlagStruct) []models.Match {
+	before, after := fs.ContextLines()
+	var edges []models.Match
+	add := func(j int) {
+		edges = append(edges, models.Match{
+			LineNumber: j + 1,
+			ByteOffset: offsets[j],
+			Line:       bytes.Clone(lines[j]),
+			Kind:       models.KindContext,
+		})
+	}
+	head := min(after, len(lines))
+	for j := 0; j < head; j++ {
+		add(j)
+	}
+	for j := max(head, len(lines)-before); j < len(lines); j++ {
+		add(j)
+	}
+	return edges
+}
+
+// EdgeContext - дополняет строки файла, собранного из чанков, контекстом (-A, -B, -C),
+// оставшимся в соседних чанках. edges - крайние строки чанков по номерам строк в файле
+func EdgeContext(matches []models.Match, edges map[int]models.Match, fs options.FlagStruct) []models.Match {
+	before, after := fs.ContextLines()
+	if len(edges) == 0 || before+after == 0 {
+		return matches
+	}
+
+	present := make(map[int]bool, len(matches))
+	for _, m := range matches {
+		present[m.LineNumber] = true
+	}
+	var extra []models.Match
+	for _, m := range matches {
+		if m.Kind != models.KindMatch {
+			continue
 		}
-		return nil
+		for n := m.LineNumber - before; n <= m.LineNumber+after; n++ {
+			if edge, ok := edges[n]; ok && !present[n] {
+				extra = append(extra, edge)
+				present[n] = true
+			}
+		}
+	}
+	if len(extra) == 0 {
+		return matches
 	}
 
-	// Определяем контекст на основе флагов
-	before := 0
-	after := 0
+	matches = append(matches, extra...)
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].LineNumber < matches[j].LineNumber })
+	return matches
+}
 
-	if *fs.CFlag > 0 {
-		before = *fs.CFlag
-		after = *fs.CFlag
+// selectLines - построчный режим: выбирает строки, в которых есть вхождение (или нет при -v)
+func selectLines(matcher Matcher, lines [][]byte, fs options.FlagStruct) ([]bool, func(j int) []models.Submatch) {
+	selected := make([]bool, len(lines))
+	for i, line := range lines {
+		selected[i] = matcher.Match(line) != *fs.VFlag
 	}
-	if *fs.BFlag > 0 {
-		before = *fs.BFlag
+
+	template := []byte(*fs.ReplaceFlag)
+	submatches := func(j int) []models.Submatch {
+		subs := matcher.FindAll(lines[j])
+		if fs.ReplaceSet {
+			for k := range subs {
+				subs[k].Replacement = expand(matcher, template, lines[j], subs[k])
+			}
+		}
+		return subs
 	}
-	if *fs.AFlag > 0 {
-		after = *fs.AFlag
+	return selected, submatches
+}
+
+// selectMultiline - многострочный режим (-U): шаблон ищется по всему буферу,
+// выбираются все строки, которых касается вхождение, начавшееся в окне.
+// Поиск начинается с начала перекрытия перед окном, чтобы вхождение, пересекающее
+// границу с предыдущим чанком, было поглощено так же, как при последовательном поиске
+func selectMultiline(matcher Matcher, data []byte, win Window, lines [][]byte, offsets []int64, fs options.FlagStruct) ([]bool, func(j int) []models.Submatch) {
+	// Начало поиска - первая целая строка перекрытия
+	from := int64(0)
+	if win.Start > 0 {
+		if i := bytes.IndexByte(data[:win.Start], '\n'); i >= 0 {
+			from = int64(i) + 1
+		} else {
+			from = win.Start
+		}
 	}
 
-	// Обрабатываем контекст и выводим результат
-	printed := make(map[int]bool)
-	var output bytes.Buffer
+	selected := make([]bool, len(lines))
+	perLine := make(map[int][]models.Submatch)
+	template := []byte(*fs.ReplaceFlag)
+
+	for _, sub := range matcher.FindAll(data[from:]) {
+		// Смещения вхождения относительно начала окна
+		start := int64(sub.Start) + from - win.Start
+		end := int64(sub.End) + from - win.Start
+		if start < 0 || start >= win.End-win.Start {
+			continue
+		}
 
-	for i, isMatch := range matches {
-		if isMatch {
-			start := max(0, i-before)
-			end := min(len(lines)-1, i+after)
+		var replacement []byte
+		if fs.ReplaceSet {
+			replacement = expand(matcher, template, data[from:], sub)
+		}
 
-			for j := start; j <= end; j++ {
-				if !printed[j] {
-					if *fs.NFlag {
-						// Определяем тип строки: совпадение или контекст
-						if matches[j] { // Это строка совпадения
-							output.WriteString(fmt.Sprintf("%d:", lineNumbers[j]))
-						} else { // Это контекстная строка
-							output.WriteString(fmt.Sprintf("%d-", lineNumbers[j]))
-						}
-					}
-					output.WriteString(lines[j] + "\n")
-					printed[j] = true
+		first := lineIndex(offsets, start)
+		last := first
+		if end > start {
+			last = lineIndex(offsets, end-1)
+		}
+		for j := first; j <= last && j < len(lines); j++ {
+			selected[j] = true
+			piece := models.Submatch{
+				Start: int(max(start, offsets[j]) - offsets[j]),
+				End:   int(min(end, offsets[j]+int64(len(lines[j]))) - offsets[j]),
+			}
+			if piece.End < piece.Start {
+				piece.End = piece.Start
+			}
+			if fs.ReplaceSet {
+				// Замена выводится в первой строке вхождения, в остальных строках его части удаляются
+				piece.Replacement = []byte{}
+				if j == first {
+					piece.Replacement = replacement
 				}
 			}
+			perLine[j] = append(perLine[j], piece)
+		}
+	}
+
+	if *fs.VFlag {
+		for j := range selected {
+			selected[j] = !selected[j]
 		}
 	}
+	return selected, func(j int) []models.Submatch { return perLine[j] }
+}
 
-	// Выводим результат
-	_, err = writer.Write(output.Bytes())
-	return err
+// lineIndex - индекс строки, содержащей смещение offset
+func lineIndex(offsets []int64, offset int64) int {
+	return sort.Search(len(offsets), func(i int) bool { return offsets[i] > offset }) - 1
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
+// cancelCheckInterval - как часто (в строках) проверять отмену при потоковом чтении
+const cancelCheckInterval = 1024
+
+// searchFirst - читает вход построчно до первой выбранной строки, не загружая его целиком
+func searchFirst(ctx context.Context, input io.Reader, matcher Matcher, invert bool, res *models.FileResult) error {
+	reader := bufio.NewReader(input)
+	var offset int64
+
+	for {
+		if res.LineCount%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			res.LineCount++
+			lineStart := offset
+			offset += int64(len(line))
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			line = bytes.TrimSuffix(line, []byte{'\r'})
+
+			if matcher.Match(line) != invert {
+				res.Matches = append(res.Matches, models.Match{
+					LineNumber: res.LineCount,
+					ByteOffset: lineStart,
+					Line:       line,
+					Kind:       models.KindMatch,
+				})
+				res.ByteCount = offset
+				return nil
+			}
+		}
+		if err == io.EOF {
+			res.ByteCount = offset
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading input: %v", err)
+		}
 	}
-	return b
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// splitLines - разбивает данные на строки без символов перевода строки.
+// offsets[i] - смещение начала i-й строки
+func splitLines(data []byte) ([][]byte, []int64) {
+	lines := make([][]byte, 0, bytes.Count(data, []byte{'\n'})+1)
+	offsets := make([]int64, 0, cap(lines))
+
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n')
+		next := len(data)
+		if end >= 0 {
+			end += start
+			next = end + 1
+		} else {
+			end = len(data)
+		}
+		line := bytes.TrimSuffix(data[start:end], []byte{'\r'})
+		lines = append(lines, line[:len(line):len(line)])
+		offsets = append(offsets, int64(start))
+		start = next
 	}
-	return b
+	return lines, offsets
 }
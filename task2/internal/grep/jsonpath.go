@@ -0,0 +1,256 @@
+package grep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// Что делать со строками, которые не являются JSON (--json-invalid)
+const (
+	jsonInvalidSkip = "skip"
+	jsonInvalidPass = "pass"
+)
+
+// jsonMatcher - поиск по JSON Lines: строка декодируется, шаблон применяется
+// к значению по пути --json-path, условия --json-field сравнивают значения полей.
+// Значение строки JSON сравнивается в декодированном виде, остальные значения - как текст JSON
+type jsonMatcher struct {
+	inner      Matcher  // шаблон для значения по path (nil, если --json-path не задан)
+	path       []string // путь к значению: ключи объектов и индексы массивов
+	conds      []jsonCond
+	passBroken bool // выбирать строки, которые не являются JSON
+	invert     bool // -v: вызывающий инвертирует результат Match
+	foldCase   bool // сравнивать значения --json-field без учёта регистра
+}
+
+// jsonCond - условие --json-field путь=значение
+type jsonCond struct {
+	path  []string
+	value string
+}
+
+// jsonValue - значение внутри строки: декодированный текст и его сырой вид
+type jsonValue struct {
+	text  []byte
+	raw   []byte
+	start int // смещение raw в строке
+}
+
+// newJSONMatcher - создаёт jsonMatcher; inner - Matcher шаблона без флагов JSON
+func newJSONMatcher(inner Matcher, fs options.FlagStruct) (*jsonMatcher, error) {
+	m := &jsonMatcher{foldCase: ignoreCase(fs), invert: *fs.VFlag}
+
+	switch *fs.JSONInvalidFlag {
+	case jsonInvalidSkip:
+	case jsonInvalidPass:
+		m.passBroken = true
+	default:
+		return nil, fmt.Errorf("--json-invalid must be %q or %q", jsonInvalidSkip, jsonInvalidPass)
+	}
+
+	if *fs.JSONPathFlag != "" {
+		m.inner = inner
+		m.path = parseJSONPath(*fs.JSONPathFlag)
+	}
+	for _, cond := range *fs.JSONFieldFlag {
+		path, value, ok := strings.Cut(cond, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid --json-field %q, expected PATH=VALUE", cond)
+		}
+		m.conds = append(m.conds, jsonCond{path: parseJSONPath(path), value: value})
+	}
+	return m, nil
+}
+
+// parseJSONPath - разбирает путь вида .request.user.id (ведущая точка необязательна)
+func parseJSONPath(path string) []string {
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func (m *jsonMatcher) Match(line []byte) bool {
+	if !json.Valid(line) {
+		// --json-invalid решает, выбрана ли строка, уже после -v: результат
+		// инвертируется заранее, чтобы -v его не перевернул
+		return m.passBroken != m.invert
+	}
+	for _, cond := range m.conds {
+		value, ok := findJSONValue(line, cond.path)
+		if !ok || !m.equal(value.text, cond.value) {
+			return false
+		}
+	}
+	if m.inner == nil {
+		return true
+	}
+	value, ok := findJSONValue(line, m.path)
+	return ok && m.inner.Match(value.text)
+}
+
+// FindAll - вхождения шаблона в значении по --json-path либо, без него,
+// значения полей --json-field; позиции - в исходной строке
+func (m *jsonMatcher) FindAll(line []byte) []models.Submatch {
+	if !json.Valid(line) || !m.Match(line) {
+		return nil
+	}
+
+	var subs []models.Submatch
+	if m.inner == nil {
+		for _, cond := range m.conds {
+			if value, ok := findJSONValue(line, cond.path); ok {
+				subs = append(subs, models.Submatch{Start: value.rawIndex(0), End: value.rawIndex(len(value.text))})
+			}
+		}
+		return disjointSubmatches(subs)
+	}
+
+	value, _ := findJSONValue(line, m.path)
+	for _, sub := range m.inner.FindAll(value.text) {
+		sub.Start = value.rawIndex(sub.Start)
+		sub.End = value.rawIndex(sub.End)
+		for k, pos := range sub.Groups {
+			if pos >= 0 {
+				sub.Groups[k] = value.rawIndex(pos)
+			}
+		}
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+func (m *jsonMatcher) equal(text []byte, value string) bool {
+	if m.foldCase {
+		return strings.EqualFold(string(text), value)
+	}
+	return string(text) == value
+}
+
+// findJSONValue - находит значение по пути, не декодируя строку целиком
+func findJSONValue(line []byte, path []string) (jsonValue, bool) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	raw, end, ok := walkJSON(dec, path)
+	if !ok {
+		return jsonValue{}, false
+	}
+	value := jsonValue{raw: raw, start: int(end) - len(raw), text: raw}
+	if len(raw) > 0 && raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return jsonValue{}, false
+		}
+		value.text = []byte(text)
+	}
+	return value, true
+}
+
+// walkJSON - спускается по пути и возвращает сырое значение и смещение его конца
+func walkJSON(dec *json.Decoder, path []string) (json.RawMessage, int64, bool) {
+	if len(path) == 0 {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, 0, false
+		}
+		return raw, dec.InputOffset(), true
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, 0, false
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, 0, false
+			}
+			if key == path[0] {
+				return walkJSON(dec, path[1:])
+			}
+			if !skipJSON(dec) {
+				return nil, 0, false
+			}
+		}
+	case json.Delim('['):
+		index, err := strconv.Atoi(path[0])
+		if err != nil {
+			return nil, 0, false
+		}
+		for i := 0; dec.More(); i++ {
+			if i == index {
+				return walkJSON(dec, path[1:])
+			}
+			if !skipJSON(dec) {
+				return nil, 0, false
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// skipJSON - пропускает очередное значение
+func skipJSON(dec *json.Decoder) bool {
+	var skip json.RawMessage
+	return dec.Decode(&skip) == nil
+}
+
+// rawIndex - смещение в строке, соответствующее смещению i в декодированном значении.
+// В строках JSON учитываются открывающая кавычка и escape-последовательности
+func (v jsonValue) rawIndex(i int) int {
+	if len(v.raw) == 0 || v.raw[0] != '"' {
+		return v.start + i
+	}
+	pos := 1
+	for decoded := 0; decoded < i && pos < len(v.raw)-1; {
+		if v.raw[pos] != '\\' {
+			pos++
+			decoded++
+			continue
+		}
+		if v.raw[pos+1] != 'u' {
+			pos += 2
+			decoded++
+			continue
+		}
+		// \uXXXX, возможно суррогатная пара \uXXXX\uXXXX
+		r, size := decodeJSONEscape(v.raw[pos:])
+		pos += size
+		decoded += utf8.RuneLen(r)
+	}
+	return v.start + pos
+}
+
+// decodeJSONEscape - руна и длина escape-последовательности \uXXXX в начале raw
+func decodeJSONEscape(raw []byte) (rune, int) {
+	if len(raw) < 6 {
+		return utf8.RuneError, len(raw)
+	}
+	r1, err := strconv.ParseUint(string(raw[2:6]), 16, 16)
+	if err != nil {
+		return utf8.RuneError, 6
+	}
+	if utf16.IsSurrogate(rune(r1)) && len(raw) >= 12 && raw[6] == '\\' && raw[7] == 'u' {
+		if r2, err := strconv.ParseUint(string(raw[8:12]), 16, 16); err == nil {
+			if r := utf16.DecodeRune(rune(r1), rune(r2)); r != utf8.RuneError {
+				return r, 12
+			}
+		}
+	}
+	if utf16.IsSurrogate(rune(r1)) {
+		return utf8.RuneError, 6
+	}
+	return rune(r1), 6
+}
@@ -0,0 +1,89 @@
+package grep
+
+import (
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+func TestJSONSelection(t *testing.T) {
+	input := `{"level":"error","request":{"user":{"id":42},"path":"/api"},"tags":["db","slow"]}
+{"level":"info","request":{"user":{"id":7},"path":"/health"},"tags":["db"]}
+not json at all
+{"level":"ERROR","msg":"a \"quoted\" \u00e9rror"}
+`
+	line1 := `{"level":"error","request":{"user":{"id":42},"path":"/api"},"tags":["db","slow"]}`
+	line2 := `{"level":"info","request":{"user":{"id":7},"path":"/health"},"tags":["db"]}`
+	line4 := `{"level":"ERROR","msg":"a \"quoted\" \u00e9rror"}`
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--json-path", ".request.user.id", "^4"}, line1},
+		// Ведущая точка необязательна, индексы массивов - числа
+		{[]string{"--json-path", "tags.1", "slow"}, line1},
+		{[]string{"--json-path", ".tags.0", "^db$"}, line1 + "|" + line2},
+		// Строка JSON сравнивается в декодированном виде
+		{[]string{"--json-path", ".msg", `"quoted" érror`}, line4},
+		// Объект сравнивается как текст JSON
+		{[]string{"--json-path", ".request.user", `"id":7`}, line2},
+		{[]string{"--json-path", ".missing", "."}, ""},
+		{[]string{"--json-field", "level=error"}, line1},
+		{[]string{"-i", "--json-field", "level=error"}, line1 + "|" + line4},
+		{[]string{"--json-field", "level=info", "--json-field", "request.user.id=7"}, line2},
+		{[]string{"--json-field", "level=info", "--json-field", "request.user.id=42"}, ""},
+		{[]string{"--json-field", "level=error", "--json-path", ".request.path", "api"}, line1},
+		// --json-invalid решается после -v: при skip строка не выводится и с -v
+		{[]string{"-v", "--json-field", "level=info"}, line1 + "|" + line4},
+		{[]string{"--json-invalid", "pass", "--json-field", "level=info"}, line2 + "|not json at all"},
+		{[]string{"-v", "--json-invalid", "pass", "--json-field", "level=info"}, line1 + "|not json at all|" + line4},
+	}
+	for _, tt := range tests {
+		if got := joinLines(searchString(t, input, tt.args...)); got != tt.want {
+			t.Errorf("%q:\ngot  %q\nwant %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestJSONSubmatchPositions(t *testing.T) {
+	line := `{"msg":"say \"hi\" \u00e9t\u00e9","n":12}`
+	res := searchString(t, line+"\n", "--json-path", ".msg", "-o", `"hi" .t.`)
+	if len(res.Matches) != 1 || len(res.Matches[0].Submatches) != 1 {
+		t.Fatalf("matches = %+v", res.Matches)
+	}
+	// Позиции - в исходной строке, с учётом escape-последовательностей
+	sub := res.Matches[0].Submatches[0]
+	if got := line[sub.Start:sub.End]; got != `\"hi\" \u00e9t\u00e9` {
+		t.Errorf("submatch covers %q", got)
+	}
+
+	// Без --json-path подсвечиваются значения полей --json-field
+	res = searchString(t, line+"\n", "--json-field", "n=12", "--json-field", "msg=say \"hi\" été")
+	if len(res.Matches) != 1 || len(res.Matches[0].Submatches) != 2 {
+		t.Fatalf("matches = %+v", res.Matches)
+	}
+	subs := res.Matches[0].Submatches
+	if got := line[subs[0].Start:subs[0].End]; got != `say \"hi\" \u00e9t\u00e9` {
+		t.Errorf("first field value covers %q", got)
+	}
+	if got := line[subs[1].Start:subs[1].End]; got != "12" {
+		t.Errorf("second field value covers %q", got)
+	}
+}
+
+func TestJSONFlagErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--json-invalid", "keep", "--json-field", "a=b"},
+		{"--json-field", "novalue"},
+		{"--json-field", "=x"},
+		{"-U", "--json-path", ".a", "x"},
+	} {
+		fs, _, err := options.Parse(args)
+		if err != nil {
+			t.Fatalf("parse %q: %v", args, err)
+		}
+		if _, err := NewMatcher(*fs); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+}
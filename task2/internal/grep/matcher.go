@@ -0,0 +1,305 @@
+package grep
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// Matcher - алгоритм поиска шаблона в строке. Реализации должны быть безопасны
+// для одновременного использования из нескольких воркеров.
+type Matcher interface {
+	// Match сообщает, есть ли в строке вхождение шаблона
+	Match(line []byte) bool
+	// FindAll возвращает позиции всех вхождений шаблона в строке
+	FindAll(line []byte) []models.Submatch
+}
+
+// Expander - Matcher, умеющий подставлять группы захвата вхождения
+// в шаблон замены ($1, ${name}) через regexp.Expand
+type Expander interface {
+	Expand(dst, template, line []byte, sub models.Submatch) []byte
+}
+
+// literalExpander - выражение без групп: для Matcher без групп захвата
+// в шаблоне замены доступно только всё вхождение ($0)
+var literalExpander = regexp.MustCompile("")
+
+// expand - подставляет вхождение sub в шаблон замены; результат не nil даже для пустой замены
+func expand(matcher Matcher, template, line []byte, sub models.Submatch) []byte {
+	dst := make([]byte, 0, len(template))
+	if expander, ok := matcher.(Expander); ok {
+		return expander.Expand(dst, template, line, sub)
+	}
+	return literalExpander.Expand(dst, template, line, []int{sub.Start, sub.End})
+}
+
+// NewMatcher - создаёт Matcher по флагам: фильтр JSON Lines (--json-path, --json-field)
+// поверх шаблона, логическое выражение (--query), приближённый поиск (--fuzzy), регулярное
+// выражение либо, для -F без учёта регистра, сравнение по простому свёртыванию
+// регистра Unicode (в многострочном режиме всегда используется регулярное выражение)
+func NewMatcher(fs options.FlagStruct) (Matcher, error) {
+	if *fs.ToFlag != "" && !fs.RangeMode() {
+		return nil, fmt.Errorf("--to requires --from")
+	}
+	if fs.RangeMode() && (*fs.QueryFlag != "" || *fs.MultilineFlag) {
+		return nil, fmt.Errorf("--from cannot be combined with --query or -U")
+	}
+	if fs.FieldMode() && (fs.RangeMode() || *fs.MultilineFlag) {
+		return nil, fmt.Errorf("field selection cannot be combined with --from or -U")
+	}
+	if fs.TailMode() && (fs.RangeMode() || *fs.MultilineFlag || *fs.CSVFlag) {
+		return nil, fmt.Errorf("--reverse and --tail-matches cannot be combined with --from, -U or --csv")
+	}
+	if fs.Operation() == models.OperationReplace && *fs.MultilineFlag {
+		// Замена переписывает файл построчно
+		return nil, fmt.Errorf("--in-place and --dry-run cannot be combined with -U")
+	}
+	if fs.FieldMode() {
+		if _, err := newFieldSpec(fs); err != nil {
+			return nil, err
+		}
+	}
+	if fs.JSONMode() {
+		if *fs.MultilineFlag {
+			return nil, fmt.Errorf("--json-path and --json-field cannot be combined with -U")
+		}
+		// Шаблон применяется к значению внутри строки
+		plainFS := fs
+		noPath, noFields := "", []string(nil)
+		plainFS.JSONPathFlag, plainFS.JSONFieldFlag = &noPath, &noFields
+		inner, err := NewMatcher(plainFS)
+		if err != nil {
+			return nil, err
+		}
+		return newJSONMatcher(inner, fs)
+	}
+	if *fs.QueryFlag != "" {
+		if *fs.MultilineFlag {
+			return nil, fmt.Errorf("--query cannot be combined with -U")
+		}
+		return newQueryMatcher(*fs.QueryFlag, fs)
+	}
+	if fs.Fuzzy() {
+		return newFuzzyMatcher(fs.Pattern, *fs.FuzzyFlag, ignoreCase(fs))
+	}
+	if *fs.FFlag && ignoreCase(fs) && !*fs.MultilineFlag {
+		return newFoldMatcher(fs.Pattern), nil
+	}
+	re, err := CompilePattern(fs)
+	if err != nil {
+		return nil, err
+	}
+	return &regexMatcher{re: re}, nil
+}
+
+// disjointSubmatches - сортирует вхождения нескольких шаблонов и убирает пересекающиеся,
+// оставляя более раннее (при равном начале - более длинное)
+func disjointSubmatches(subs []models.Submatch) []models.Submatch {
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].Start != subs[j].Start {
+			return subs[i].Start < subs[j].Start
+		}
+		return subs[i].End > subs[j].End
+	})
+
+	result := subs[:0]
+	for _, sub := range subs {
+		if len(result) > 0 && sub.Start < result[len(result)-1].End {
+			continue
+		}
+		result = append(result, sub)
+	}
+	return result
+}
+
+// CompilePattern - компилирует шаблон с учётом флагов -F, -i, -S и -U
+func CompilePattern(fs options.FlagStruct) (*regexp.Regexp, error) {
+	pattern := fs.Pattern
+	if *fs.FFlag {
+		// Фиксированная строка - экранируем спецсимволы
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase(fs) {
+		// Игнорирование регистра
+		pattern = "(?i)" + pattern
+	}
+	if *fs.MultilineFlag {
+		// ^ и $ - границы строк внутри буфера; при --multiline-dotall '.' захватывает и '\n'
+		if *fs.DotallFlag {
+			pattern = "(?s)" + pattern
+		}
+		pattern = "(?m)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fs.Pattern: %v", err)
+	}
+	return re, nil
+}
+
+// ignoreCase - нужно ли игнорировать регистр: -i, либо -S и в шаблоне нет заглавных букв
+func ignoreCase(fs options.FlagStruct) bool {
+	if *fs.IFlag {
+		return true
+	}
+	return *fs.SmartCaseFlag && !hasUpper(fs.Pattern, *fs.FFlag || fs.Fuzzy())
+}
+
+// hasUpper - есть ли в шаблоне заглавные буквы. Для регулярного выражения
+// учитываются только литералы, чтобы экранирования вроде \S или \W не считались
+func hasUpper(pattern string, literal bool) bool {
+	if literal {
+		return containsUpper([]rune(pattern))
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return containsUpper([]rune(pattern))
+	}
+	return literalHasUpper(re)
+}
+
+func literalHasUpper(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpLiteral && containsUpper(re.Rune) {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if literalHasUpper(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsUpper(runes []rune) bool {
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexMatcher - поиск регулярным выражением
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m *regexMatcher) Match(line []byte) bool {
+	return m.re.Match(line)
+}
+
+func (m *regexMatcher) FindAll(line []byte) []models.Submatch {
+	locs := m.re.FindAllSubmatchIndex(line, -1)
+	if len(locs) == 0 {
+		return nil
+	}
+	subs := make([]models.Submatch, 0, len(locs))
+	for _, loc := range locs {
+		sub := models.Submatch{Start: loc[0], End: loc[1]}
+		if len(loc) > 2 {
+			sub.Groups = loc
+		}
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// Expand - подставляет группы захвата вхождения в шаблон замены
+func (m *regexMatcher) Expand(dst, template, line []byte, sub models.Submatch) []byte {
+	match := sub.Groups
+	if match == nil {
+		match = []int{sub.Start, sub.End}
+	}
+	return m.re.Expand(dst, template, line, match)
+}
+
+// SubexpNames - имена групп захвата (для шаблонов вывода)
+func (m *regexMatcher) SubexpNames() []string {
+	return m.re.SubexpNames()
+}
+
+// foldMatcher - поиск фиксированной строки без учёта регистра по простому
+// свёртыванию регистра Unicode (unicode.SimpleFold): одинаково работает для
+// латиницы, кириллицы и греческого, включая варианты вроде σ/ς/Σ
+type foldMatcher struct {
+	pattern []rune // шаблон, приведённый к канонической форме
+}
+
+func newFoldMatcher(pattern string) *foldMatcher {
+	runes := []rune(pattern)
+	for i, r := range runes {
+		runes[i] = foldRune(r)
+	}
+	return &foldMatcher{pattern: runes}
+}
+
+func (m *foldMatcher) Match(line []byte) bool {
+	_, ok := m.index(line, 0)
+	return ok
+}
+
+func (m *foldMatcher) FindAll(line []byte) []models.Submatch {
+	var subs []models.Submatch
+	for start := 0; start <= len(line); {
+		end, ok := m.index(line, start)
+		if !ok {
+			break
+		}
+		subs = append(subs, models.Submatch{Start: end[0], End: end[1]})
+		if end[1] > end[0] {
+			start = end[1]
+		} else {
+			start = end[1] + 1
+		}
+	}
+	return subs
+}
+
+// index - ищет первое вхождение начиная с from, возвращает [начало, конец)
+func (m *foldMatcher) index(line []byte, from int) ([2]int, bool) {
+	if len(m.pattern) == 0 {
+		return [2]int{from, from}, from <= len(line)
+	}
+	for i := from; i < len(line); {
+		if end, ok := m.matchAt(line, i); ok {
+			return [2]int{i, end}, true
+		}
+		_, size := utf8.DecodeRune(line[i:])
+		i += size
+	}
+	return [2]int{}, false
+}
+
+// matchAt - совпадает ли шаблон со строкой начиная с позиции i; возвращает конец вхождения
+func (m *foldMatcher) matchAt(line []byte, i int) (int, bool) {
+	for _, want := range m.pattern {
+		if i >= len(line) {
+			return 0, false
+		}
+		r, size := utf8.DecodeRune(line[i:])
+		if foldRune(r) != want {
+			return 0, false
+		}
+		i += size
+	}
+	return i, true
+}
+
+// foldRune - каноническая форма руны: минимальная руна в её орбите SimpleFold
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
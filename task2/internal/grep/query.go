@@ -0,0 +1,276 @@
+package grep
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// queryNode - узел дерева логического выражения --query
+type queryNode struct {
+	op    string // "AND", "OR", "NOT" или "" для терма
+	left  *queryNode
+	right *queryNode
+	term  int // индекс терма в queryMatcher.terms
+}
+
+// queryMatcher - выбор строк по логическому выражению над термами:
+// литералами (слово или "строка в кавычках") и регулярными выражениями (/regex/).
+// Выражение вычисляется за один проход по строке, каждый терм проверяется не более одного раза
+type queryMatcher struct {
+	root     *queryNode
+	terms    []Matcher
+	positive []bool // терм входит в выражение без отрицания - его вхождения подсвечиваются
+}
+
+// newQueryMatcher - разбирает выражение; термы компилируются с учётом -i, -S и --fuzzy
+func newQueryMatcher(query string, fs options.FlagStruct) (*queryMatcher, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, fs: fs, m: &queryMatcher{}}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("query: unexpected %q", p.tokens[p.pos].text)
+	}
+	p.m.root = root
+	p.m.markPositive(root, true)
+	return p.m, nil
+}
+
+func (m *queryMatcher) Match(line []byte) bool {
+	cache := make([]int8, len(m.terms)) // 0 - не проверялся, 1 - есть, -1 - нет
+	return m.eval(m.root, line, cache)
+}
+
+// FindAll - вхождения всех положительных термов, если строка удовлетворяет выражению
+func (m *queryMatcher) FindAll(line []byte) []models.Submatch {
+	if !m.Match(line) {
+		return nil
+	}
+
+	var subs []models.Submatch
+	for i, term := range m.terms {
+		if m.positive[i] {
+			subs = append(subs, term.FindAll(line)...)
+		}
+	}
+	return disjointSubmatches(subs)
+}
+
+func (m *queryMatcher) eval(node *queryNode, line []byte, cache []int8) bool {
+	switch node.op {
+	case "AND":
+		return m.eval(node.left, line, cache) && m.eval(node.right, line, cache)
+	case "OR":
+		return m.eval(node.left, line, cache) || m.eval(node.right, line, cache)
+	case "NOT":
+		return !m.eval(node.left, line, cache)
+	}
+
+	if cache[node.term] == 0 {
+		cache[node.term] = -1
+		if m.terms[node.term].Match(line) {
+			cache[node.term] = 1
+		}
+	}
+	return cache[node.term] > 0
+}
+
+// markPositive - отмечает термы, стоящие под чётным числом отрицаний
+func (m *queryMatcher) markPositive(node *queryNode, positive bool) {
+	switch node.op {
+	case "AND", "OR":
+		m.markPositive(node.left, positive)
+		m.markPositive(node.right, positive)
+	case "NOT":
+		m.markPositive(node.left, !positive)
+	default:
+		if positive {
+			m.positive[node.term] = true
+		}
+	}
+}
+
+// queryToken - лексема выражения
+type queryToken struct {
+	kind string // "(", ")", "AND", "OR", "NOT", "word", "regex"
+	text string
+}
+
+// tokenizeQuery - разбивает выражение на лексемы
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, queryToken{kind: string(r), text: string(r)})
+			i++
+		case r == '"' || r == '/':
+			text, next, err := readQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := "word"
+			if r == '/' {
+				kind = "regex"
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: text})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				i++
+			}
+			word := string(runes[start:i])
+			switch word {
+			case "AND", "OR", "NOT":
+				tokens = append(tokens, queryToken{kind: word, text: word})
+			default:
+				tokens = append(tokens, queryToken{kind: "word", text: word})
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// readQuoted - читает "строку" или /regex/ начиная с открывающего символа;
+// закрывающий символ внутри экранируется обратной косой чертой
+func readQuoted(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var text strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == quote:
+			text.WriteRune(quote)
+			i++
+		case runes[i] == quote:
+			return text.String(), i + 1, nil
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return "", 0, fmt.Errorf("query: unterminated %c", quote)
+}
+
+// queryParser - рекурсивный спуск:
+//
+//	or    := and ("OR" and)*
+//	and   := unary (["AND"] unary)*
+//	unary := "NOT" unary | "(" or ")" | term
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	fs     options.FlagStruct
+	m      *queryMatcher
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].kind
+	}
+	return ""
+}
+
+func (p *queryParser) parseOr() (*queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryNode{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (*queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "AND":
+			p.pos++
+		case "NOT", "(", "word", "regex":
+			// Термы, записанные подряд, объединяются через AND
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryNode{op: "AND", left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseUnary() (*queryNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("query: unexpected end of expression")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch tok.kind {
+	case "NOT":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{op: "NOT", left: operand}, nil
+	case "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("query: missing ')'")
+		}
+		p.pos++
+		return node, nil
+	case "word", "regex":
+		return p.term(tok)
+	default:
+		return nil, fmt.Errorf("query: unexpected %q", tok.text)
+	}
+}
+
+// term - создаёт Matcher терма: слово - фиксированная строка, /.../ - регулярное выражение
+func (p *queryParser) term(tok queryToken) (*queryNode, error) {
+	termFS := p.fs
+	termFS.Pattern = tok.text
+	literal := tok.kind == "word"
+	termFS.FFlag = &literal
+	noQuery := ""
+	termFS.QueryFlag = &noQuery
+	if !literal {
+		termFS.FuzzySet = false
+	}
+
+	matcher, err := NewMatcher(termFS)
+	if err != nil {
+		return nil, fmt.Errorf("query term %q: %v", tok.text, err)
+	}
+	p.m.terms = append(p.m.terms, matcher)
+	p.m.positive = append(p.m.positive, false)
+	return &queryNode{term: len(p.m.terms) - 1}, nil
+}
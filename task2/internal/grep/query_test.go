@@ -0,0 +1,132 @@
+package grep
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// compileQuery - Matcher для --query expr с дополнительными флагами args
+func compileQuery(t *testing.T, expr string, args ...string) Matcher {
+	t.Helper()
+	fs, _, err := options.Parse(append(args, "--query", expr))
+	if err != nil {
+		t.Fatalf("parse %q: %v", args, err)
+	}
+	matcher, err := NewMatcher(*fs)
+	if err != nil {
+		t.Fatalf("query %q: %v", expr, err)
+	}
+	return matcher
+}
+
+func TestQuerySelectsLines(t *testing.T) {
+	lines := []string{
+		"timeout in db",
+		"timeout in cache, retry",
+		"timeout somewhere",
+		"db is fine",
+		`said "two words" here`,
+		"code=503",
+	}
+	tests := []struct {
+		expr string
+		want []int // номера выбранных строк из lines
+	}{
+		{"timeout AND (db OR cache) AND NOT retry", []int{0}},
+		// Термы подряд объединяются через AND, AND связывает сильнее OR
+		{"timeout db", []int{0}},
+		{"db OR cache timeout", []int{0, 1, 3}},
+		{"NOT timeout", []int{3, 4, 5}},
+		{"NOT NOT db", []int{0, 3}},
+		{`"two words"`, []int{4}},
+		{`"two  words"`, nil},
+		{`/code=5\d\d/ OR /^db/`, []int{3, 5}},
+		// Слово - фиксированная строка, а не регулярное выражение
+		{"code=5..", nil},
+	}
+	for _, tt := range tests {
+		matcher := compileQuery(t, tt.expr)
+		var got []int
+		for i, line := range lines {
+			if matcher.Match([]byte(line)) {
+				got = append(got, i)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q selected %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestQueryCaseFlags(t *testing.T) {
+	line := []byte("Timeout in DB")
+	if compileQuery(t, "timeout db").Match(line) {
+		t.Error("query is case-sensitive by default")
+	}
+	if !compileQuery(t, "timeout /d./", "-i").Match(line) {
+		t.Error("-i applies to every term")
+	}
+	// -S: каждый терм решает сам - без заглавных букв регистр не учитывается
+	if !compileQuery(t, "timeout DB", "-S").Match(line) {
+		t.Error("-S: lowercase term should ignore case")
+	}
+	if compileQuery(t, "timeout Db", "-S").Match(line) {
+		t.Error("-S: term with uppercase should match case")
+	}
+}
+
+func TestQueryHighlightsPositiveTerms(t *testing.T) {
+	// Подсвечиваются вхождения термов не под NOT; из пересекающихся остаётся начавшееся раньше
+	matcher := compileQuery(t, `err AND NOT debug AND (/no\b/ OR rr OR missing)`)
+	got := matcher.FindAll([]byte("error: errno debugger"))
+	if got != nil {
+		t.Errorf("line excluded by NOT highlighted %+v", got)
+	}
+	got = matcher.FindAll([]byte("error: errno"))
+	want := []models.Submatch{{Start: 0, End: 3}, {Start: 7, End: 10}, {Start: 10, End: 12}}
+	if len(got) != len(want) {
+		t.Fatalf("submatches = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Start != want[i].Start || got[i].End != want[i].End {
+			t.Errorf("submatch %d = [%d, %d), want [%d, %d)", i, got[i].Start, got[i].End, want[i].Start, want[i].End)
+		}
+	}
+
+	res := searchString(t, "debug err\nerr ok\n", "-o", "--query", "err NOT debug")
+	if len(res.Matches) != 1 || res.Matches[0].LineNumber != 2 {
+		t.Errorf("-o --query matches = %+v", res.Matches)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, expr := range []string{
+		"a AND",
+		"(a OR b",
+		"a )",
+		`"open`,
+		"/unterminated",
+		"/a(/",
+		"NOT",
+		"OR a",
+	} {
+		fs, _, err := options.Parse([]string{"--query", expr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewMatcher(*fs); err == nil {
+			t.Errorf("query %q accepted", expr)
+		}
+	}
+
+	fs, _, err := options.Parse([]string{"-U", "--query", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMatcher(*fs); err == nil {
+		t.Error("--query accepted together with -U")
+	}
+}
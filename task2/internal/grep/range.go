@@ -0,0 +1,95 @@
+package grep
+
+import (
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// rangeSelector - выбор блоков строк от строки, совпавшей с --from, до следующей
+// строки, совпавшей с --to (как sed -n '/START/,/END/p'). Без --to блок длится до конца файла
+type rangeSelector struct {
+	from        Matcher
+	to          Matcher // nil, если --to не задан
+	excludeFrom bool
+	excludeTo   bool
+}
+
+// newRangeSelector - создаёт выбор диапазонов; START и END компилируются
+// с теми же флагами, что и обычный шаблон (-F, -i, -S, --fuzzy)
+func newRangeSelector(fs options.FlagStruct) (*rangeSelector, error) {
+	r := &rangeSelector{
+		excludeFrom: *fs.ExcludeFromFlag,
+		excludeTo:   *fs.ExcludeToFlag,
+	}
+
+	fromFS := fs
+	fromFS.Pattern = *fs.FromFlag
+	from, err := NewMatcher(fromFS)
+	if err != nil {
+		return nil, err
+	}
+	r.from = from
+
+	if *fs.ToFlag != "" {
+		toFS := fs
+		toFS.Pattern = *fs.ToFlag
+		if r.to, err = NewMatcher(toFS); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// step - обрабатывает строку при состоянии open (внутри блока);
+// возвращает, выбрана ли строка, и состояние после неё.
+// Как и в sed, строка, открывшая блок, не может его закрыть
+func (r *rangeSelector) step(line []byte, open bool) (selected, next bool) {
+	if !open {
+		if r.from.Match(line) {
+			return !r.excludeFrom, true
+		}
+		return false, false
+	}
+	if r.to != nil && r.to.Match(line) {
+		return !r.excludeTo, false
+	}
+	return true, true
+}
+
+// submatches - вхождения START и END в строке (для подсветки и -o)
+func (r *rangeSelector) submatches(line []byte) []models.Submatch {
+	subs := r.from.FindAll(line)
+	if r.to != nil {
+		subs = append(subs, r.to.FindAll(line)...)
+	}
+	return disjointSubmatches(subs)
+}
+
+// selectRange - выбирает строки для закрытого диапазона в начале данных, а также
+// для открытого (блок начался раньше, в предыдущем чанке) - до строки, после которой
+// оба варианта совпадают. Возвращает выбор для закрытого начала, выбор для открытого
+// (действителен для первых openLines строк) и состояния в конце для обоих вариантов
+func selectRange(r *rangeSelector, lines [][]byte, invert bool) (selected, openSelected []bool, openLines int, endOpen, openEndOpen bool) {
+	selected = make([]bool, len(lines))
+	states := make([]bool, len(lines))
+	state := false
+	for i, line := range lines {
+		selected[i], state = r.step(line, state)
+		selected[i] = selected[i] != invert
+		states[i] = state
+	}
+	endOpen = state
+
+	openSelected = make([]bool, len(lines))
+	state = true
+	for i, line := range lines {
+		openSelected[i], state = r.step(line, state)
+		openSelected[i] = openSelected[i] != invert
+		if state == states[i] {
+			// Дальше варианты не различаются
+			copy(openSelected[i+1:], selected[i+1:])
+			return selected, openSelected, i + 1, endOpen, endOpen
+		}
+	}
+	return selected, openSelected, len(lines), endOpen, state
+}
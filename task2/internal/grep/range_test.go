@@ -0,0 +1,91 @@
+package grep
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// selectedLines - номера выбранных (не контекстных) строк результата
+func selectedLines(t *testing.T, input string, args ...string) []int {
+	t.Helper()
+	var lines []int
+	for _, m := range searchString(t, input, args...).Matches {
+		if m.Kind == models.KindMatch {
+			lines = append(lines, m.LineNumber)
+		}
+	}
+	return lines
+}
+
+func TestRangeBlocks(t *testing.T) {
+	input := "a\nSTART\nb\nEND\nc\nSTART END\nd\nEND\nSTART\ne\n"
+	tests := []struct {
+		args []string
+		want []int
+	}{
+		// Последний блок не закрыт и длится до конца файла
+		{[]string{"--from", "START", "--to", "END"}, []int{2, 3, 4, 6, 7, 8, 9, 10}},
+		// Строка, открывшая блок, не закрывает его, даже если совпадает с END
+		{[]string{"--from", "START", "--to", "END", "--exclude-from"}, []int{3, 4, 7, 8, 10}},
+		{[]string{"--from", "START", "--to", "END", "--exclude-to"}, []int{2, 3, 6, 7, 9, 10}},
+		{[]string{"--from", "START", "--to", "END", "--exclude-from", "--exclude-to"}, []int{3, 7, 10}},
+		{[]string{"--from", "START"}, []int{2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{[]string{"-v", "--from", "START", "--to", "END"}, []int{1, 5}},
+		{[]string{"-i", "--from", "start", "--to", "^end$"}, []int{2, 3, 4, 6, 7, 8, 9, 10}},
+	}
+	for _, tt := range tests {
+		if got := selectedLines(t, input, tt.args...); !slices.Equal(got, tt.want) {
+			t.Errorf("%q selected %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRangeHighlightsBounds(t *testing.T) {
+	res := searchString(t, "x START y\ninside\nEND\n", "--from", "START", "--to", "END")
+	if len(res.Matches) != 3 {
+		t.Fatalf("matches = %+v", res.Matches)
+	}
+	// Подсвечиваются вхождения START и END, у строк внутри блока вхождений нет
+	if subs := res.Matches[0].Submatches; len(subs) != 1 || subs[0].Start != 2 || subs[0].End != 7 {
+		t.Errorf("START submatches = %+v", subs)
+	}
+	if subs := res.Matches[1].Submatches; len(subs) != 0 {
+		t.Errorf("inner line submatches = %+v", subs)
+	}
+	if subs := res.Matches[2].Submatches; len(subs) != 1 || subs[0].End != 3 {
+		t.Errorf("END submatches = %+v", subs)
+	}
+}
+
+func TestSelectRangeOpenStart(t *testing.T) {
+	fs, _, err := options.Parse([]string{"--from", "START", "--to", "END"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRangeSelector(*fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := [][]byte{[]byte("in"), []byte("END"), []byte("out"), []byte("START"), []byte("in")}
+
+	selected, openSelected, openLines, endOpen, openEndOpen := selectRange(r, lines, false)
+	if want := []bool{false, false, false, true, true}; !slices.Equal(selected, want) {
+		t.Errorf("closed start selected %v, want %v", selected, want)
+	}
+	// При открытом начале варианты расходятся только до строки END включительно
+	if want := []bool{true, true, false, true, true}; !slices.Equal(openSelected, want) {
+		t.Errorf("open start selected %v, want %v", openSelected, want)
+	}
+	if openLines != 2 || !endOpen || !openEndOpen {
+		t.Errorf("openLines = %d, endOpen = %v, openEndOpen = %v", openLines, endOpen, openEndOpen)
+	}
+
+	// Без END блок, открытый раньше, не закрывается до конца фрагмента
+	_, openSelected, openLines, endOpen, openEndOpen = selectRange(r, lines[2:3], false)
+	if !openSelected[0] || openLines != 1 || endOpen || !openEndOpen {
+		t.Errorf("no END: open %v, openLines = %d, endOpen = %v, openEndOpen = %v", openSelected, openLines, endOpen, openEndOpen)
+	}
+}
@@ -0,0 +1,79 @@
+package grep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// Replace переписывает входной поток, заменяя вхождения шаблона по --replace.
+// Возвращает новое содержимое и изменённые строки (исходный текст с заменами
+// в Submatches), номера строк считаются от начала input
+func Replace(ctx context.Context, input io.Reader, fs options.FlagStruct) ([]byte, models.FileResult, error) {
+	var res models.FileResult
+
+	matcher, err := NewMatcher(fs)
+	if err != nil {
+		return nil, res, err
+	}
+	template := []byte(*fs.ReplaceFlag)
+
+	reader := bufio.NewReader(input)
+	var out bytes.Buffer
+	var offset int64
+
+	for {
+		if res.LineCount%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, res, err
+			}
+		}
+
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) > 0 {
+			res.LineCount++
+			line, ending := SplitLineEnding(raw)
+
+			subs := matcher.FindAll(line)
+			if len(subs) == 0 {
+				out.Write(raw)
+			} else {
+				for i := range subs {
+					subs[i].Replacement = expand(matcher, template, line, subs[i])
+				}
+				m := models.Match{
+					LineNumber: res.LineCount,
+					ByteOffset: offset,
+					Line:       line,
+					Submatches: subs,
+					Kind:       models.KindMatch,
+				}
+				res.Matches = append(res.Matches, m)
+				out.Write(m.Replaced())
+				out.Write(ending)
+			}
+			offset += int64(len(raw))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, res, fmt.Errorf("error reading input: %v", err)
+		}
+	}
+
+	res.ByteCount = offset
+	return out.Bytes(), res, nil
+}
+
+// SplitLineEnding - отделяет от строки её окончание ("\n", "\r\n" или пустое)
+func SplitLineEnding(raw []byte) ([]byte, []byte) {
+	line := bytes.TrimSuffix(raw, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	return line, raw[len(line):]
+}
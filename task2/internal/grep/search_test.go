@@ -0,0 +1,85 @@
+package grep
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// searchString - ищет по input с флагами командной строки args (шаблон - среди них)
+func searchString(t *testing.T, input string, args ...string) models.FileResult {
+	t.Helper()
+	fs, rest, err := options.Parse(args)
+	if err != nil {
+		t.Fatalf("parse %q: %v", args, err)
+	}
+	if len(rest) > 0 {
+		t.Fatalf("unexpected arguments %q", rest)
+	}
+	res, err := Search(context.Background(), strings.NewReader(input), *fs)
+	if err != nil {
+		t.Fatalf("search %q: %v", args, err)
+	}
+	return res
+}
+
+func TestSearchMatchRecords(t *testing.T) {
+	input := "start\r\nerr one\nok\nok\nerr err\nend"
+	res := searchString(t, input, "-C1", "err")
+
+	want := []models.Match{
+		{LineNumber: 1, ByteOffset: 0, Line: []byte("start"), Kind: models.KindContext},
+		{LineNumber: 2, ByteOffset: 7, Line: []byte("err one"), Kind: models.KindMatch, Submatches: []models.Submatch{{Start: 0, End: 3}}},
+		{LineNumber: 3, ByteOffset: 15, Line: []byte("ok"), Kind: models.KindContext},
+		{LineNumber: 4, ByteOffset: 18, Line: []byte("ok"), Kind: models.KindContext},
+		{LineNumber: 5, ByteOffset: 21, Line: []byte("err err"), Kind: models.KindMatch, Submatches: []models.Submatch{{Start: 0, End: 3}, {Start: 4, End: 7}}},
+		{LineNumber: 6, ByteOffset: 29, Line: []byte("end"), Kind: models.KindContext},
+	}
+	if len(res.Matches) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(res.Matches), len(want), res.Matches)
+	}
+	for i, m := range res.Matches {
+		w := want[i]
+		if m.LineNumber != w.LineNumber || m.ByteOffset != w.ByteOffset || string(m.Line) != string(w.Line) || m.Kind != w.Kind {
+			t.Errorf("line %d = {%d %d %q %v}, want {%d %d %q %v}", i, m.LineNumber, m.ByteOffset, m.Line, m.Kind, w.LineNumber, w.ByteOffset, w.Line, w.Kind)
+		}
+		if len(m.Submatches) != len(w.Submatches) {
+			t.Errorf("line %d submatches = %+v, want %+v", i, m.Submatches, w.Submatches)
+			continue
+		}
+		for j, sub := range m.Submatches {
+			if sub.Start != w.Submatches[j].Start || sub.End != w.Submatches[j].End {
+				t.Errorf("line %d submatch %d = [%d, %d), want [%d, %d)", i, j, sub.Start, sub.End, w.Submatches[j].Start, w.Submatches[j].End)
+			}
+		}
+	}
+	if res.LineCount != 6 || res.ByteCount != int64(len(input)) {
+		t.Errorf("counted %d lines, %d bytes", res.LineCount, res.ByteCount)
+	}
+}
+
+func TestSearchInvertHasNoSubmatches(t *testing.T) {
+	res := searchString(t, "a\nb\na\n", "-v", "a")
+	if len(res.Matches) != 1 || string(res.Matches[0].Line) != "b" || res.Matches[0].LineNumber != 2 {
+		t.Fatalf("matches = %+v", res.Matches)
+	}
+	if m := res.Matches[0]; m.Kind != models.KindMatch || m.Submatches != nil {
+		t.Errorf("inverted match = %+v", m)
+	}
+}
+
+func TestSearchCountIgnoresContext(t *testing.T) {
+	// При -c контекст не собирается: в результате только выбранные строки
+	res := searchString(t, "x\na\nx\na\nx\n", "-c", "-C2", "a")
+	for _, m := range res.Matches {
+		if m.Kind != models.KindMatch {
+			t.Errorf("context line %d with -c", m.LineNumber)
+		}
+	}
+	if CountSelected(res.Matches) != 2 {
+		t.Errorf("selected %d lines, want 2", CountSelected(res.Matches))
+	}
+}
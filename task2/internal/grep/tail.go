@@ -0,0 +1,57 @@
+package grep
+
+import (
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// Tail - оставляет в результате последние --tail-matches выбранных строк вместе
+// с их контекстом и при --reverse переставляет строки от конца файла к началу
+func Tail(res models.FileResult, fs options.FlagStruct) models.FileResult {
+	if limit := *fs.TailMatchesFlag; limit > 0 {
+		res.Matches = lastSelected(res.Matches, limit, fs)
+	}
+	if *fs.ReverseFlag {
+		reversed := make([]models.Match, len(res.Matches))
+		for i, m := range res.Matches {
+			reversed[len(reversed)-1-i] = m
+		}
+		res.Matches = reversed
+	}
+	return res
+}
+
+// lastSelected - строки начиная с limit-й с конца выбранной строки и её контекста до
+func lastSelected(matches []models.Match, limit int, fs options.FlagStruct) []models.Match {
+	cut := -1
+	for i, count := len(matches)-1, 0; i >= 0; i-- {
+		if matches[i].Kind == models.KindMatch {
+			count++
+			if count == limit {
+				cut = i
+				break
+			}
+		}
+	}
+	if cut < 0 {
+		return matches
+	}
+
+	before, _ := fs.ContextLines()
+	first := matches[cut].LineNumber
+	for cut > 0 && matches[cut-1].Kind == models.KindContext && matches[cut-1].LineNumber >= first-before {
+		cut--
+	}
+	return matches[cut:]
+}
+
+// CountSelected - количество выбранных (не контекстных) строк
+func CountSelected(matches []models.Match) int {
+	count := 0
+	for _, m := range matches {
+		if m.Kind == models.KindMatch {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,43 @@
+package grep
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// tailLines - номера строк результата после Tail с флагами args
+func tailLines(t *testing.T, input string, args ...string) []int {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, m := range Tail(searchString(t, input, args...), *fs).Matches {
+		lines = append(lines, m.LineNumber)
+	}
+	return lines
+}
+
+func TestTail(t *testing.T) {
+	input := "a\nx\na\nx\nx\na\nx\na\n"
+	tests := []struct {
+		args []string
+		want []int
+	}{
+		{[]string{"--tail-matches", "2", "a"}, []int{6, 8}},
+		// Контекст перед первой оставленной строкой сохраняется, но не раньше -B строк
+		{[]string{"--tail-matches", "2", "-B1", "a"}, []int{5, 6, 7, 8}},
+		{[]string{"--tail-matches", "3", "-C1", "a"}, []int{2, 3, 4, 5, 6, 7, 8}},
+		{[]string{"--tail-matches", "10", "a"}, []int{1, 3, 6, 8}},
+		{[]string{"--reverse", "a"}, []int{8, 6, 3, 1}},
+		{[]string{"--reverse", "--tail-matches", "2", "-A1", "a"}, []int{8, 7, 6}},
+	}
+	for _, tt := range tests {
+		if got := tailLines(t, input, tt.args...); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: lines %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
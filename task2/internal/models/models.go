@@ -1,22 +1,45 @@
 package models
 
-import "github.com/pozedorum/WB_project_4/task2/internal/chunks"
+import (
+	"time"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+)
 
 type Task struct {
 	ID        int
 	FilePath  string
-	Chunk     chunks.Chunk // для больших файлов
-	Operation string       // "grep", "cut", "sort"
+	Chunk     chunks.Chunk   // для больших файлов
+	Batch     []chunks.Chunk // несколько чанков маленьких файлов одной задачей (Chunk - первый из них)
+	Overlap   int64          // -U: сколько байт соседних чанков читается с каждой стороны
+	Operation string         // "grep", "cut", "sort"
 	Pattern   string
 }
 
+// Parts - чанки задачи
+func (t Task) Parts() []chunks.Chunk {
+	if len(t.Batch) > 0 {
+		return t.Batch
+	}
+	return []chunks.Chunk{t.Chunk}
+}
+
 type Result struct {
-	TaskID   int
-	WorkerID int
-	Lines    []string
-	Error    error
-	FilePath string // важно для сборки обратно
-	ChunkID  int    // для сборки чанков
+	TaskID      int
+	WorkerID    int
+	Matches     []Match // выбранные и контекстные строки чанка (для replace - изменённые строки)
+	Data        []byte  // переписанное содержимое чанка (для replace)
+	LineCount   int     // количество строк в чанке
+	ByteCount   int64   // количество байт в чанке
+	Elapsed     time.Duration
+	Error       error
+	FilePath    string      // важно для сборки обратно
+	FileIndex   int         // номер файла среди аргументов: по нему чанки собираются в файлы
+	ChunkID     int         // для сборки чанков
+	Range       *RangeState // состояние диапазона --from/--to на границах чанка
+	Edges       []Match     // крайние строки чанка для контекста выбранных строк соседних чанков
+	LinesBefore int         // строк файла до чанка, если поиск идёт не с начала файла
+	Changed     bool        // файл изменился после разметки, но прочитан (--on-change=warn)
 }
 
 // ChunkMetadata - метаинформация для сборки результатов
@@ -28,8 +51,91 @@ type ChunkMetadata struct {
 	ByteCount int64 // Количество обработанных байт
 }
 
+// MatchKind - тип выводимой строки
+type MatchKind int
+
+const (
+	KindMatch   MatchKind = iota // строка, выбранная шаблоном
+	KindContext                  // контекстная строка (-A, -B, -C)
+)
+
+// Submatch - позиция вхождения шаблона внутри строки (в байтах)
+type Submatch struct {
+	Start  int
+	End    int
+	Groups []int // пары начало/конец для групп захвата (0-я пара - всё вхождение), -1 если группа не участвовала
+
+	Replacement []byte // результат подстановки --replace (nil, если замена не задана)
+	Distance    int    // расстояние редактирования до шаблона (для --fuzzy)
+}
+
+// Match - одна выводимая строка вместе с её положением в файле
+type Match struct {
+	FilePath   string
+	LineNumber int   // номер строки, начиная с 1
+	ByteOffset int64 // смещение начала строки от начала файла
+	Line       []byte
+	Submatches []Submatch
+	Kind       MatchKind
+}
+
+// Replaced - строка, в которой вхождения заменены на результат --replace
+func (m Match) Replaced() []byte {
+	if len(m.Submatches) == 0 || m.Submatches[0].Replacement == nil {
+		return m.Line
+	}
+	line := make([]byte, 0, len(m.Line))
+	prev := 0
+	for _, sub := range m.Submatches {
+		line = append(line, m.Line[prev:sub.Start]...)
+		line = append(line, sub.Replacement...)
+		prev = sub.End
+	}
+	return append(line, m.Line[prev:]...)
+}
+
+// FileResult - результат поиска по одному файлу целиком
+type FileResult struct {
+	FilePath  string
+	FileIndex int // номер файла среди аргументов (для результатов, собранных из чанков)
+	Matches   []Match
+	LineCount int
+	ByteCount int64
+	Elapsed   time.Duration
+	Error     error
+	Range     *RangeState
+	Edges     []Match // первые -A и последние -B строк фрагмента (контекст для соседних фрагментов)
+}
+
+// RangeState - результат выбора диапазонов --from/--to для фрагмента файла.
+// Основной результат считается для закрытого диапазона в начале фрагмента;
+// если в начале он открыт (блок начался в предыдущем чанке), выбор первых
+// OpenLines строк отличается и берётся из OpenMatches
+type RangeState struct {
+	EndOpen     bool    // открыт ли диапазон в конце фрагмента при закрытом начале
+	OpenMatches []Match // строки, выбранные при открытом начале, с номерами не больше OpenLines
+	OpenLines   int     // число первых строк, после которых оба варианта совпадают (вместе с контекстом -A)
+	OpenEndOpen bool    // открыт ли диапазон в конце фрагмента при открытом начале
+}
+
+// Resolve - строки фрагмента с учётом состояния диапазона в его начале:
+// closed - результат для закрытого начала. Возвращает также состояние в конце фрагмента
+func (r *RangeState) Resolve(closed []Match, open bool) ([]Match, bool) {
+	if !open {
+		return closed, r.EndOpen
+	}
+	matches := append([]Match{}, r.OpenMatches...)
+	for _, m := range closed {
+		if m.LineNumber > r.OpenLines {
+			matches = append(matches, m)
+		}
+	}
+	return matches, r.OpenEndOpen
+}
+
 const (
-	OperationGrep = "grep"
+	OperationGrep    = "grep"
+	OperationReplace = "replace"
 	// OperationCut  = "cut"
 	// OperationSort = "sort"
 )
@@ -2,61 +2,224 @@
 package options
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
 	flag "github.com/spf13/pflag"
 )
 
 type FlagStruct struct {
-	AFlag          *int
-	BFlag          *int
-	CFlag          *int
-	SmallCFlag     *bool
-	IFlag          *bool
-	VFlag          *bool
-	FFlag          *bool
-	NFlag          *bool
-	ConcurrentMode *int
-	Pattern        string
+	AFlag            *int
+	BFlag            *int
+	CFlag            *int
+	SmallCFlag       *bool
+	IFlag            *bool
+	SmartCaseFlag    *bool
+	VFlag            *bool
+	FFlag            *bool
+	NFlag            *bool
+	JSONFlag         *bool
+	FormatFlag       *string
+	ColumnFlag       *bool
+	ColumnRunes      *bool
+	VimgrepFlag      *bool
+	BigHFlag         *bool
+	SmallHFlag       *bool
+	LabelFlag        *string
+	NullFlag         *bool
+	QuietFlag        *bool
+	OnlyMatchingFlag *bool
+	ReplaceFlag      *string
+	ReplaceSet       bool // --replace задан (в том числе пустой строкой)
+	InPlaceFlag      *bool
+	BackupFlag       *string
+	DryRunFlag       *bool
+	MultilineFlag    *bool
+	DotallFlag       *bool
+	FuzzyFlag        *int
+	FuzzySet         bool // --fuzzy задан (в том числе с K = 0)
+	QueryFlag        *string
+	FromFlag         *string
+	ToFlag           *string
+	ExcludeFromFlag  *bool
+	ExcludeToFlag    *bool
+	DelimiterFlag    *string
+	FieldFlag        *string
+	CSVFlag          *bool
+	PrintFieldsFlag  *bool
+	JSONPathFlag     *string
+	JSONFieldFlag    *[]string
+	JSONInvalidFlag  *string
+	SinceFlag        *string
+	UntilFlag        *string
+	TimeFormatFlag   *string
+	LinesFlag        *string
+	BytesFlag        *string
+	ReverseFlag      *bool
+	TailMatchesFlag  *int
+	FollowFlag       *bool
+	FollowInterval   *time.Duration
+	ChunkSizeFlag    *string
+	PlanInFlag       *string
+	OnChangeFlag     *string
+	MmapFlag         *bool
+	MaxOpenFlag      *int
+	OnChangeSet      bool // --on-change задан явно
+	ConcurrentMode   *int
+	Pattern          string
+	Command          string // подкоманда (CommandPlan) или пусто для поиска
 }
 
+// CommandPlan - подкоманда plan: вывести план разбиения файлов на чанки вместо поиска
+const CommandPlan = "plan"
+
+// ParseOptions - разбирает аргументы программы; при ошибке выводит справку
+// и завершает программу (код 2, без шаблона - код 1)
 func ParseOptions() (*FlagStruct, []string) {
+	set := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs, args, err := parse(set, os.Args[1:])
+	switch {
+	case err == nil:
+		return fs, args
+	case errors.Is(err, flag.ErrHelp):
+		// Справку pflag уже вывел
+		os.Exit(0)
+	case errors.Is(err, errNoPattern):
+		set.Usage()
+		os.Exit(1)
+	}
+	// Как ошибки разбора флагов в pflag: справка, сообщение и код 2
+	set.Usage()
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+	return nil, nil
+}
+
+// Parse - разбирает аргументы командной строки без имени программы, ничего не выводя
+// (например, в тестах)
+func Parse(arguments []string) (*FlagStruct, []string, error) {
+	set := flag.NewFlagSet("grep", flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	return parse(set, arguments)
+}
+
+// errNoPattern - не задан ни шаблон, ни заменяющие его --query, --from, --json-field
+var errNoPattern = errors.New("no pattern given")
+
+// parse - регистрирует флаги в set и разбирает по ним аргументы
+func parse(set *flag.FlagSet, arguments []string) (*FlagStruct, []string, error) {
 	var fs FlagStruct
 
-	fs.AFlag = flag.IntP("A", "A", 0, "Print N lines after each match")
-	fs.BFlag = flag.IntP("B", "B", 0, "Print N lines before each match")
-	fs.CFlag = flag.IntP("C", "C", 0, "Print N lines around each match (A+B)")
-	fs.SmallCFlag = flag.BoolP("c", "c", false, "Only print count of matching lines")
-	fs.IFlag = flag.BoolP("i", "i", false, "Ignore case distinctions")
-	fs.VFlag = flag.BoolP("v", "v", false, "Select non-matching lines")
-	fs.FFlag = flag.BoolP("F", "F", false, "Interpret pattern as literal string")
-	fs.NFlag = flag.BoolP("n", "n", false, "Print line numbers with output")
+	fs.AFlag = set.IntP("A", "A", 0, "Print N lines after each match")
+	fs.BFlag = set.IntP("B", "B", 0, "Print N lines before each match")
+	fs.CFlag = set.IntP("C", "C", 0, "Print N lines around each match (A+B)")
+	fs.SmallCFlag = set.BoolP("c", "c", false, "Only print count of matching lines")
+	fs.IFlag = set.BoolP("i", "i", false, "Ignore case distinctions")
+	fs.SmartCaseFlag = set.BoolP("smart-case", "S", false, "Ignore case unless the pattern contains an uppercase letter")
+	fs.VFlag = set.BoolP("v", "v", false, "Select non-matching lines")
+	fs.FFlag = set.BoolP("F", "F", false, "Interpret pattern as literal string")
+	fs.NFlag = set.BoolP("n", "n", false, "Print line numbers with output")
+	fs.JSONFlag = set.Bool("json", false, "Print results in JSON Lines format")
+	fs.ColumnFlag = set.Bool("column", false, "Print the 1-based column of the first match (implies -n)")
+	fs.ColumnRunes = set.Bool("column-runes", false, "Count columns in runes instead of bytes")
+	fs.VimgrepFlag = set.Bool("vimgrep", false, "Print every match as path:line:col:text")
+	fs.BigHFlag = set.BoolP("with-filename", "H", false, "Print the file name for each match")
+	fs.SmallHFlag = set.BoolP("no-filename", "h", false, "Suppress the file name prefix on output")
+	fs.LabelFlag = set.String("label", "(standard input)", "Use LABEL as the file name for standard input")
+	fs.NullFlag = set.BoolP("null", "Z", false, "Output a zero byte after the file name instead of ':'")
+	fs.QuietFlag = set.BoolP("quiet", "q", false, "Print nothing, exit 0 on the first selected line")
+	fs.OnlyMatchingFlag = set.BoolP("only-matching", "o", false, "Print only the matched parts of a line")
+	fs.ReplaceFlag = set.StringP("replace", "r", "", "Replace every match with TEMPLATE in the output ($1, ${name} refer to capture groups)")
+	fs.InPlaceFlag = set.Bool("in-place", false, "Rewrite matching lines in the files using --replace")
+	fs.BackupFlag = set.String("backup", "", "With --in-place, keep the original file with SUFFIX appended")
+	fs.DryRunFlag = set.Bool("dry-run", false, "With --in-place, print a unified diff instead of changing files")
+	fs.MultilineFlag = set.BoolP("multiline", "U", false, "Allow matches to span lines")
+	fs.DotallFlag = set.Bool("multiline-dotall", false, "With -U, let '.' match newlines")
+	fs.FuzzyFlag = set.Int("fuzzy", 0, "Match the pattern as a literal allowing up to K insertions, deletions or substitutions")
+	fs.QueryFlag = set.String("query", "", "Select lines by a boolean expression of terms, e.g. 'timeout AND (db OR cache) AND NOT retry'")
+	fs.FromFlag = set.String("from", "", "Print blocks of lines starting at a line matching START (like sed -n '/START/,/END/p')")
+	fs.ToFlag = set.String("to", "", "With --from, end each block at the next line matching END")
+	fs.ExcludeFromFlag = set.Bool("exclude-from", false, "With --from, do not print the line that starts a block")
+	fs.ExcludeToFlag = set.Bool("exclude-to", false, "With --to, do not print the line that ends a block")
+	fs.DelimiterFlag = set.String("delimiter", "", "Split lines into fields by DELIM (default tab, or ',' with --csv)")
+	fs.FieldFlag = set.String("field", "", "Apply the pattern only to the listed 1-based fields, e.g. 3 or 1,4-6")
+	fs.CSVFlag = set.Bool("csv", false, "Parse input as CSV with RFC 4180 quoting (records may span lines)")
+	fs.PrintFieldsFlag = set.Bool("print-fields", false, "With --field, print only the selected fields instead of the whole row")
+	fs.JSONPathFlag = set.String("json-path", "", "Decode each line as JSON and apply the pattern to the value at PATH, e.g. .request.user.id")
+	fs.JSONFieldFlag = set.StringArray("json-field", nil, "Select JSON lines whose field PATH equals VALUE (PATH=VALUE, may be repeated)")
+	fs.JSONInvalidFlag = set.String("json-invalid", "skip", "What to do with lines that are not JSON: skip or pass")
+	fs.SinceFlag = set.String("since", "", "Search only lines logged at or after TIME (timestamp or duration back from now, e.g. 1h)")
+	fs.UntilFlag = set.String("until", "", "Search only lines logged at or before TIME")
+	fs.TimeFormatFlag = set.String("time-format", "", "Go layout of line timestamps for --since/--until (auto-detected by default)")
+	fs.LinesFlag = set.String("lines", "", "Search only lines FIRST:LAST of each file (1-based, inclusive; either side may be omitted)")
+	fs.BytesFlag = set.String("bytes", "", "Search only lines starting in the byte range START:END of each file (suffixes K, M, G, T)")
+	fs.ReverseFlag = set.Bool("reverse", false, "Print selected lines from the end of each file backwards")
+	fs.TailMatchesFlag = set.Int("tail-matches", 0, "Print only the last N selected lines of each file, reading it from the end")
+	fs.FollowFlag = set.Bool("follow", false, "Keep watching the files after the search and print selected lines as they are appended (like tail -F)")
+	fs.FollowInterval = set.Duration("follow-interval", time.Second, "How often --follow checks the files for new data")
+	fs.FormatFlag = set.String("format", "", "Print each match using a template, e.g. '{path}:{line}:{col}: {text}'")
 
-	ePattern := flag.StringP("e", "e", "", "Pattern to search for")
+	ePattern := set.StringP("e", "e", "", "Pattern to search for")
 
 	// 	ФЛАГ ВКЛЮЧЕНИЯ РАСПРЕДЕЛЁННОЙ ВЕРСИИ УТИЛИТЫ
-	fs.ConcurrentMode = flag.IntP("Q", "Q", 1, "Turn on concurrent mode and set workers count")
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] -e PATTERN [FILE...]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "       %s [OPTIONS] PATTERN [FILE...]\n", os.Args[0])
-		flag.PrintDefaults()
+	fs.ConcurrentMode = set.IntP("Q", "Q", 1, "Turn on concurrent mode and set workers count")
+	fs.ChunkSizeFlag = set.String("chunk-size", "", "Split files into chunks of SIZE bytes (suffixes K, M, G); chosen from the input size and -Q by default")
+	fs.PlanInFlag = set.String("plan-in", "", "Search the chunks of a plan saved by the plan command instead of FILE arguments")
+	fs.MaxOpenFlag = set.Int("max-open", 64, "Keep at most N files open at once in concurrent mode; files are opened only when their chunks are processed")
+	fs.MmapFlag = set.Bool("mmap", false, "Memory-map files and let workers search the mapped chunks directly (falls back to reads for pipes and special files)")
+	fs.OnChangeFlag = set.String("on-change", "fail", "What to do when a file changes after it was split into chunks: fail, warn or snapshot (ignore appended data)")
+	set.Usage = func() {
+		out, name := set.Output(), set.Name()
+		fmt.Fprintf(out, "Usage: %s [OPTIONS] -e PATTERN [FILE...]\n", name)
+		fmt.Fprintf(out, "       %s [OPTIONS] PATTERN [FILE...]\n", name)
+		fmt.Fprintf(out, "       %s [OPTIONS] --query EXPR [FILE...]\n", name)
+		fmt.Fprintf(out, "       %s [OPTIONS] --from START [--to END] [FILE...]\n", name)
+		fmt.Fprintf(out, "       %s [OPTIONS] --json-field PATH=VALUE [FILE...]\n", name)
+		fmt.Fprintf(out, "       %s plan [--chunk-size SIZE] [-Q N] FILE...\n", name)
+		set.PrintDefaults()
 	}
 
-	flag.Parse()
+	// Подкоманда - только первым аргументом: "plan" в другом месте остаётся шаблоном
+	if len(arguments) > 0 && arguments[0] == CommandPlan {
+		fs.Command = CommandPlan
+		arguments = arguments[1:]
+	}
+	if err := set.Parse(arguments); err != nil {
+		return nil, nil, err
+	}
+	fs.ReplaceSet = set.Changed("replace")
+	fs.OnChangeSet = set.Changed("on-change")
+	fs.FuzzySet = set.Changed("fuzzy")
+	if fs.FuzzySet && *fs.FuzzyFlag < 0 {
+		return nil, nil, fmt.Errorf("invalid argument \"%d\" for \"--fuzzy\" flag: K must not be negative", *fs.FuzzyFlag)
+	}
 
-	args := flag.Args()
+	args := set.Args()
 
-	if *ePattern != "" {
+	if fs.Command == CommandPlan {
+		// Плану шаблон не нужен, все аргументы - файлы
+	} else if *ePattern != "" {
 		fs.Pattern = *ePattern
+	} else if *fs.QueryFlag != "" {
+		// Выражение --query заменяет шаблон
+		fs.Pattern = *fs.QueryFlag
+	} else if *fs.FromFlag != "" {
+		// В режиме диапазона шаблоном служит START
+		fs.Pattern = *fs.FromFlag
+	} else if len(*fs.JSONFieldFlag) > 0 && *fs.JSONPathFlag == "" {
+		// Строки выбираются только условиями --json-field, шаблон не нужен
 	} else if len(args) < 1 {
-		flag.Usage()
-		os.Exit(1)
+		return nil, nil, errNoPattern
 	} else {
 		fs.Pattern = args[0]
 		args = args[1:]
 	}
-	return &fs, args
+	return &fs, args, nil
 }
 
 func (fs *FlagStruct) PrintFlags() {
@@ -70,6 +233,80 @@ func (fs *FlagStruct) PrintFlags() {
 	fmt.Println("flag i -", *(fs.IFlag))
 }
 
+// Operation - операция, которую выполняют воркеры: поиск или замена в файлах (--in-place, --dry-run)
+func (fs *FlagStruct) Operation() string {
+	if *fs.InPlaceFlag || *fs.DryRunFlag {
+		return models.OperationReplace
+	}
+	return models.OperationGrep
+}
+
+// Fuzzy - включён ли приближённый поиск (--fuzzy K)
+func (fs *FlagStruct) Fuzzy() bool {
+	return fs.FuzzySet
+}
+
+// RangeMode - выбираются ли блоки строк между --from и --to
+func (fs *FlagStruct) RangeMode() bool {
+	return *fs.FromFlag != ""
+}
+
+// FieldMode - ищется ли шаблон по отдельным полям строки (--delimiter, --field, --csv)
+func (fs *FlagStruct) FieldMode() bool {
+	return *fs.CSVFlag || *fs.DelimiterFlag != "" || *fs.FieldFlag != ""
+}
+
+// JSONMode - декодируются ли строки как JSON (--json-path, --json-field)
+func (fs *FlagStruct) JSONMode() bool {
+	return *fs.JSONPathFlag != "" || len(*fs.JSONFieldFlag) > 0
+}
+
+// NeedLineNumbers - выводятся ли номера строк (-n, --column, --json, --vimgrep, --format)
+func (fs *FlagStruct) NeedLineNumbers() bool {
+	return *fs.NFlag || *fs.ColumnFlag || *fs.JSONFlag || *fs.VimgrepFlag || *fs.FormatFlag != ""
+}
+
+// ContextLines - сколько строк контекста выводится до и после выбранной (-A, -B, -C);
+// при подсчёте (-c) и с -q строки не выводятся и контекст не нужен
+func (fs *FlagStruct) ContextLines() (before, after int) {
+	if *fs.SmallCFlag || *fs.QuietFlag {
+		return 0, 0
+	}
+	if *fs.CFlag > 0 {
+		before = *fs.CFlag
+		after = *fs.CFlag
+	}
+	if *fs.BFlag > 0 {
+		before = *fs.BFlag
+	}
+	if *fs.AFlag > 0 {
+		after = *fs.AFlag
+	}
+	return before, after
+}
+
+// TailMode - читаются ли файлы от конца к началу (--reverse, --tail-matches)
+func (fs *FlagStruct) TailMode() bool {
+	return *fs.ReverseFlag || *fs.TailMatchesFlag > 0
+}
+
+// ChangePolicy - что делать с файлом, изменившимся после разметки на чанки (--on-change).
+// При --follow файлы дописываются по ходу поиска, поэтому по умолчанию - snapshot
+func (fs *FlagStruct) ChangePolicy() (chunks.ChangePolicy, error) {
+	if *fs.FollowFlag && !fs.OnChangeSet {
+		return chunks.OnChangeSnapshot, nil
+	}
+	return chunks.ParseChangePolicy(*fs.OnChangeFlag)
+}
+
+// WithFilename - нужно ли выводить имя файла перед строками (-H, -h или несколько файлов)
+func (fs *FlagStruct) WithFilename(filesCount int) bool {
+	if *fs.SmallHFlag {
+		return false
+	}
+	return *fs.BigHFlag || filesCount > 1
+}
+
 func (fs *FlagStruct) Validate() error {
 	if fs.Pattern == "" {
 		return fmt.Errorf("pattern cannot be empty")
@@ -77,5 +314,6 @@ func (fs *FlagStruct) Validate() error {
 	if *fs.AFlag < 0 || *fs.BFlag < 0 || *fs.CFlag < 0 {
 		return fmt.Errorf("context flags cannot be negative")
 	}
+
 	return nil
 }
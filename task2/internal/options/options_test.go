@@ -0,0 +1,75 @@
+package options
+
+import "testing"
+
+func TestWithFilename(t *testing.T) {
+	tests := []struct {
+		args  []string
+		files int
+		want  bool
+	}{
+		{[]string{"x"}, 1, false},
+		{[]string{"x"}, 2, true},
+		{[]string{"-H", "x"}, 1, true},
+		{[]string{"-h", "x"}, 3, false},
+		// -h сильнее -H, как в GNU grep при порядке -H -h
+		{[]string{"-H", "-h", "x"}, 1, false},
+		{[]string{"--with-filename", "x"}, 1, true},
+		{[]string{"--no-filename", "x"}, 2, false},
+	}
+	for _, tt := range tests {
+		fs, _, err := Parse(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fs.WithFilename(tt.files); got != tt.want {
+			t.Errorf("%q with %d files: WithFilename = %v, want %v", tt.args, tt.files, got, tt.want)
+		}
+	}
+}
+
+func TestParseLabel(t *testing.T) {
+	fs, _, err := Parse([]string{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *fs.LabelFlag != "(standard input)" {
+		t.Errorf("default label = %q", *fs.LabelFlag)
+	}
+	fs, _, err = Parse([]string{"--label", "pipe", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *fs.LabelFlag != "pipe" {
+		t.Errorf("label = %q, want pipe", *fs.LabelFlag)
+	}
+}
+
+func TestChangePolicy(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"x"}, "fail"},
+		{[]string{"--on-change", "warn", "x"}, "warn"},
+		// --follow читает дописываемые файлы: по умолчанию snapshot, но явный флаг важнее
+		{[]string{"--follow", "x"}, "snapshot"},
+		{[]string{"--follow", "--on-change", "fail", "x"}, "fail"},
+	}
+	for _, tt := range tests {
+		fs, _, err := Parse(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy, err := fs.ChangePolicy(); err != nil || string(policy) != tt.want {
+			t.Errorf("%q: ChangePolicy = %q, %v; want %q", tt.args, policy, err, tt.want)
+		}
+	}
+	fs, _, err := Parse([]string{"--on-change", "skip", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ChangePolicy(); err == nil {
+		t.Error("invalid --on-change accepted")
+	}
+}
@@ -0,0 +1,225 @@
+// Package output содержит вывод результатов поиска в различных форматах
+package output
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+)
+
+// JSONPrinter выводит результаты в формате JSON Lines (по аналогии с ripgrep --json):
+// begin, match/context и end для каждого файла, в конце - summary
+type JSONPrinter struct {
+	writer  *bufio.Writer
+	started time.Time
+	total   jsonStats
+	fuzzy   bool // выводить расстояние редактирования вхождений
+}
+
+type jsonMessage struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// jsonData - текст в виде строки, либо base64, если это не UTF-8
+type jsonData struct {
+	Text  *string `json:"text,omitempty"`
+	Bytes *string `json:"bytes,omitempty"`
+}
+
+type jsonBegin struct {
+	Path jsonData `json:"path"`
+}
+
+type jsonSubmatch struct {
+	Match       jsonData  `json:"match"`
+	Replacement *jsonData `json:"replacement,omitempty"`
+	Start       int       `json:"start"`
+	End         int       `json:"end"`
+	Distance    *int      `json:"distance,omitempty"`
+}
+
+type jsonMatch struct {
+	Path           jsonData       `json:"path"`
+	Lines          jsonData       `json:"lines"`
+	LineNumber     int            `json:"line_number"`
+	AbsoluteOffset int64          `json:"absolute_offset"`
+	Submatches     []jsonSubmatch `json:"submatches"`
+}
+
+type jsonDuration struct {
+	Secs  int64  `json:"secs"`
+	Nanos int    `json:"nanos"`
+	Human string `json:"human"`
+}
+
+type jsonStats struct {
+	Elapsed           jsonDuration `json:"elapsed"`
+	Searches          int          `json:"searches"`
+	SearchesWithMatch int          `json:"searches_with_match"`
+	BytesSearched     int64        `json:"bytes_searched"`
+	BytesPrinted      int64        `json:"bytes_printed"`
+	MatchedLines      int          `json:"matched_lines"`
+	Matches           int          `json:"matches"`
+	elapsed           time.Duration
+}
+
+type jsonEnd struct {
+	Path  jsonData  `json:"path"`
+	Error *string   `json:"error,omitempty"`
+	Stats jsonStats `json:"stats"`
+}
+
+type jsonSummary struct {
+	ElapsedTotal jsonDuration `json:"elapsed_total"`
+	Stats        jsonStats    `json:"stats"`
+}
+
+// NewJSONPrinter - создаёт JSONPrinter, пишущий в writer; fuzzy - добавлять
+// к вхождениям расстояние редактирования
+func NewJSONPrinter(writer io.Writer, fuzzy bool) *JSONPrinter {
+	return &JSONPrinter{
+		writer:  bufio.NewWriter(writer),
+		started: time.Now(),
+		fuzzy:   fuzzy,
+	}
+}
+
+// PrintFile - выводит события begin, match/context и end для одного файла
+func (p *JSONPrinter) PrintFile(res models.FileResult) error {
+	stats := jsonStats{
+		Searches:      1,
+		BytesSearched: res.ByteCount,
+		elapsed:       res.Elapsed,
+	}
+
+	n, err := p.write("begin", jsonBegin{Path: newJSONData([]byte(res.FilePath))})
+	if err != nil {
+		return err
+	}
+	stats.BytesPrinted += n
+
+	for _, m := range res.Matches {
+		msgType := "context"
+		if m.Kind == models.KindMatch {
+			msgType = "match"
+			stats.MatchedLines++
+			stats.Matches += len(m.Submatches)
+		}
+		n, err := p.write(msgType, newJSONMatch(m, p.fuzzy))
+		if err != nil {
+			return err
+		}
+		stats.BytesPrinted += n
+	}
+	if stats.MatchedLines > 0 {
+		stats.SearchesWithMatch = 1
+	}
+
+	stats.Elapsed = newJSONDuration(stats.elapsed)
+	end := jsonEnd{Path: newJSONData([]byte(res.FilePath)), Stats: stats}
+	if res.Error != nil {
+		msg := res.Error.Error()
+		end.Error = &msg
+	}
+	if _, err := p.write("end", end); err != nil {
+		return err
+	}
+
+	p.total.add(stats)
+	return nil
+}
+
+// Flush - сбрасывает буфер вывода
+func (p *JSONPrinter) Flush() error {
+	return p.writer.Flush()
+}
+
+// Finish - выводит итоговое событие summary и сбрасывает буфер
+func (p *JSONPrinter) Finish() error {
+	p.total.Elapsed = newJSONDuration(p.total.elapsed)
+	summary := jsonSummary{
+		ElapsedTotal: newJSONDuration(time.Since(p.started)),
+		Stats:        p.total,
+	}
+	if _, err := p.write("summary", summary); err != nil {
+		return err
+	}
+	return p.writer.Flush()
+}
+
+// write - выводит одно событие и возвращает количество записанных байт
+func (p *JSONPrinter) write(msgType string, data any) (int64, error) {
+	line, err := json.Marshal(jsonMessage{Type: msgType, Data: data})
+	if err != nil {
+		return 0, fmt.Errorf("json encoding error: %v", err)
+	}
+	line = append(line, '\n')
+	n, err := p.writer.Write(line)
+	return int64(n), err
+}
+
+func (s *jsonStats) add(other jsonStats) {
+	s.elapsed += other.elapsed
+	s.Searches += other.Searches
+	s.SearchesWithMatch += other.SearchesWithMatch
+	s.BytesSearched += other.BytesSearched
+	s.BytesPrinted += other.BytesPrinted
+	s.MatchedLines += other.MatchedLines
+	s.Matches += other.Matches
+}
+
+func newJSONMatch(m models.Match, fuzzy bool) jsonMatch {
+	line := make([]byte, 0, len(m.Line)+1)
+	line = append(line, m.Line...)
+	line = append(line, '\n')
+
+	subs := make([]jsonSubmatch, 0, len(m.Submatches))
+	for _, sub := range m.Submatches {
+		jsonSub := jsonSubmatch{
+			Match: newJSONData(m.Line[sub.Start:sub.End]),
+			Start: sub.Start,
+			End:   sub.End,
+		}
+		if sub.Replacement != nil {
+			replacement := newJSONData(sub.Replacement)
+			jsonSub.Replacement = &replacement
+		}
+		if fuzzy {
+			distance := sub.Distance
+			jsonSub.Distance = &distance
+		}
+		subs = append(subs, jsonSub)
+	}
+
+	return jsonMatch{
+		Path:           newJSONData([]byte(m.FilePath)),
+		Lines:          newJSONData(line),
+		LineNumber:     m.LineNumber,
+		AbsoluteOffset: m.ByteOffset,
+		Submatches:     subs,
+	}
+}
+
+func newJSONData(data []byte) jsonData {
+	if utf8.Valid(data) {
+		text := string(data)
+		return jsonData{Text: &text}
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return jsonData{Bytes: &encoded}
+}
+
+func newJSONDuration(d time.Duration) jsonDuration {
+	return jsonDuration{
+		Secs:  int64(d / time.Second),
+		Nanos: int(d % time.Second),
+		Human: d.String(),
+	}
+}
@@ -0,0 +1,103 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+func TestJSONPrinterEvents(t *testing.T) {
+	fs, _, err := options.Parse([]string{"--json", "-C1", "err"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	printer, err := NewPrinter(&out, io.Discard, fs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := models.FileResult{
+		FilePath:  "app.log",
+		ByteCount: 30,
+		Matches: []models.Match{
+			{FilePath: "app.log", LineNumber: 1, ByteOffset: 0, Line: []byte("ok"), Kind: models.KindContext},
+			{FilePath: "app.log", LineNumber: 2, ByteOffset: 3, Line: []byte("err: err"), Kind: models.KindMatch,
+				Submatches: []models.Submatch{{Start: 0, End: 3}, {Start: 5, End: 8}}},
+		},
+	}
+	if err := printer.PrintFile(res); err != nil {
+		t.Fatal(err)
+	}
+	failed := models.FileResult{FilePath: "gone.log", Error: errors.New("no such file")}
+	if err := printer.PrintFile(failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := printer.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	var events []json.RawMessage
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var event struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		types = append(types, event.Type)
+		events = append(events, event.Data)
+	}
+	want := "begin context match end begin end summary"
+	if got := strings.Join(types, " "); got != want {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+
+	var match jsonMatch
+	if err := json.Unmarshal(events[2], &match); err != nil {
+		t.Fatal(err)
+	}
+	if *match.Lines.Text != "err: err\n" || match.LineNumber != 2 || match.AbsoluteOffset != 3 {
+		t.Errorf("match = %q line %d offset %d", *match.Lines.Text, match.LineNumber, match.AbsoluteOffset)
+	}
+	if len(match.Submatches) != 2 || *match.Submatches[1].Match.Text != "err" || match.Submatches[1].Start != 5 {
+		t.Errorf("submatches = %+v", match.Submatches)
+	}
+
+	var end jsonEnd
+	if err := json.Unmarshal(events[5], &end); err != nil {
+		t.Fatal(err)
+	}
+	if end.Error == nil || *end.Error != "no such file" {
+		t.Errorf("end of failed file has error %v", end.Error)
+	}
+
+	var summary jsonSummary
+	if err := json.Unmarshal(events[6], &summary); err != nil {
+		t.Fatal(err)
+	}
+	stats := summary.Stats
+	if stats.Searches != 2 || stats.SearchesWithMatch != 1 || stats.MatchedLines != 1 || stats.Matches != 2 || stats.BytesSearched != 30 {
+		t.Errorf("summary stats = %+v", stats)
+	}
+}
+
+func TestJSONDataBytes(t *testing.T) {
+	text := newJSONData([]byte("привет"))
+	if text.Text == nil || *text.Text != "привет" || text.Bytes != nil {
+		t.Errorf("UTF-8 data = %+v", text)
+	}
+	// Не UTF-8: передаётся в base64, как у ripgrep
+	raw := newJSONData([]byte{0xff, 'a'})
+	if raw.Bytes == nil || *raw.Bytes != "/2E=" || raw.Text != nil {
+		t.Errorf("binary data = %+v", raw)
+	}
+}
@@ -0,0 +1,56 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// Printer - общий интерфейс вывода результатов поиска для всех режимов
+type Printer interface {
+	// PrintFile выводит результаты по одному файлу
+	PrintFile(res models.FileResult) error
+	// Flush сбрасывает буфер, не завершая вывод (--follow выводит результаты по мере появления)
+	Flush() error
+	// Finish завершает вывод и сбрасывает буферы
+	Finish() error
+}
+
+// NewPrinter - выбирает формат вывода по флагам
+func NewPrinter(writer, errWriter io.Writer, fs *options.FlagStruct, withFilename bool) (Printer, error) {
+	switch {
+	case *fs.JSONFlag:
+		return NewJSONPrinter(writer, fs.Fuzzy()), nil
+	case *fs.VimgrepFlag:
+		return NewVimgrepPrinter(writer, errWriter, *fs.ColumnRunes, *fs.NullFlag), nil
+	case *fs.FormatFlag != "" && !*fs.SmallCFlag:
+		matcher, err := grep.NewMatcher(*fs)
+		if err != nil {
+			return nil, err
+		}
+		var groupNames []string
+		if named, ok := matcher.(interface{ SubexpNames() []string }); ok {
+			groupNames = named.SubexpNames()
+		}
+		template, err := ParseTemplate(*fs.FormatFlag, groupNames)
+		if err != nil {
+			return nil, err
+		}
+		template.CountRunes(*fs.ColumnRunes)
+		return NewTemplatePrinter(writer, errWriter, template), nil
+	default:
+		return NewTextPrinter(writer, errWriter, fs, withFilename), nil
+	}
+}
+
+// printFileError - сообщает об ошибке обработки файла, если она есть
+func printFileError(errWriter io.Writer, res models.FileResult) error {
+	if res.Error == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(errWriter, "grep: %s: %v\n", res.FilePath, res.Error)
+	return err
+}
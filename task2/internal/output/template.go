@@ -0,0 +1,281 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+)
+
+// Поля, доступные в шаблоне --format
+const (
+	fieldLiteral = iota
+	fieldPath
+	fieldLine
+	fieldCol
+	fieldOffset
+	fieldText
+	fieldMatch
+	fieldReplacement
+	fieldDistance
+	fieldGroup
+)
+
+var templateFields = map[string]int{
+	"path":   fieldPath,
+	"line":   fieldLine,
+	"col":    fieldCol,
+	"offset": fieldOffset,
+	"text":   fieldText,
+	"match":  fieldMatch,
+
+	"replacement": fieldReplacement,
+	"distance":    fieldDistance,
+}
+
+type templatePart struct {
+	field   int
+	literal string
+	group   int // номер группы захвата для fieldGroup
+}
+
+// Template - разобранный шаблон вывода вида "{path}:{line}:{col}: {text}".
+// Поддерживаются экранирования \t, \n, \\ и двойные скобки {{ }} для литералов.
+type Template struct {
+	parts []templatePart
+	runes bool // считать {col} в рунах, а не в байтах
+}
+
+// ParseTemplate - разбирает шаблон; groupNames - имена групп захвата шаблона поиска
+func ParseTemplate(format string, groupNames []string) (*Template, error) {
+	var t Template
+	var literal strings.Builder
+
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			t.parts = append(t.parts, templatePart{field: fieldLiteral, literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case c == '\\' && i+1 < len(format):
+			i++
+			switch format[i] {
+			case 't':
+				literal.WriteByte('\t')
+			case 'n':
+				literal.WriteByte('\n')
+			case '0':
+				literal.WriteByte(0)
+			default:
+				literal.WriteByte(format[i])
+			}
+		case c == '{' && i+1 < len(format) && format[i+1] == '{':
+			literal.WriteByte('{')
+			i++
+		case c == '}' && i+1 < len(format) && format[i+1] == '}':
+			literal.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed placeholder in format %q", format)
+			}
+			part, err := parsePlaceholder(format[i+1:i+end], groupNames)
+			if err != nil {
+				return nil, err
+			}
+			flushLiteral()
+			t.parts = append(t.parts, part)
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flushLiteral()
+
+	return &t, nil
+}
+
+// parsePlaceholder - определяет поле по имени: встроенное поле, номер или имя группы захвата
+func parsePlaceholder(name string, groupNames []string) (templatePart, error) {
+	if field, ok := templateFields[name]; ok {
+		return templatePart{field: field}, nil
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 && n < len(groupNames) {
+		return templatePart{field: fieldGroup, group: n}, nil
+	}
+	for i, groupName := range groupNames {
+		if groupName != "" && groupName == name {
+			return templatePart{field: fieldGroup, group: i}, nil
+		}
+	}
+	return templatePart{}, fmt.Errorf("unknown placeholder {%s} in format", name)
+}
+
+// CountRunes - переключает подсчёт {col} в рунах
+func (t *Template) CountRunes(runes bool) {
+	t.runes = runes
+}
+
+// usesMatch - обращается ли шаблон к данным конкретного вхождения
+func (t *Template) usesMatch() bool {
+	for _, part := range t.parts {
+		switch part.field {
+		case fieldCol, fieldMatch, fieldReplacement, fieldDistance, fieldGroup:
+			return true
+		}
+	}
+	return false
+}
+
+// Render - дописывает в buf строку m, отформатированную по шаблону;
+// sub - вхождение шаблона поиска (nil для строк без вхождений)
+func (t *Template) Render(buf []byte, m models.Match, sub *models.Submatch) []byte {
+	for _, part := range t.parts {
+		switch part.field {
+		case fieldLiteral:
+			buf = append(buf, part.literal...)
+		case fieldPath:
+			buf = append(buf, m.FilePath...)
+		case fieldLine:
+			buf = strconv.AppendInt(buf, int64(m.LineNumber), 10)
+		case fieldText:
+			buf = append(buf, m.Line...)
+		case fieldOffset:
+			offset := m.ByteOffset
+			if sub != nil {
+				offset += int64(sub.Start)
+			}
+			buf = strconv.AppendInt(buf, offset, 10)
+		case fieldCol:
+			start := 0
+			if sub != nil {
+				start = sub.Start
+			}
+			buf = strconv.AppendInt(buf, int64(column(m.Line, start, t.runes)), 10)
+		case fieldMatch:
+			if sub != nil {
+				buf = append(buf, m.Line[sub.Start:sub.End]...)
+			}
+		case fieldReplacement:
+			if sub != nil {
+				buf = append(buf, sub.Replacement...)
+			}
+		case fieldDistance:
+			if sub != nil {
+				buf = strconv.AppendInt(buf, int64(sub.Distance), 10)
+			}
+		case fieldGroup:
+			buf = appendGroup(buf, m.Line, sub, part.group)
+		}
+	}
+	return buf
+}
+
+// column - номер колонки (с 1) для смещения start в строке, в байтах или рунах
+func column(line []byte, start int, runes bool) int {
+	if runes {
+		return utf8.RuneCount(line[:start]) + 1
+	}
+	return start + 1
+}
+
+func appendGroup(buf, line []byte, sub *models.Submatch, group int) []byte {
+	if sub == nil {
+		return buf
+	}
+	if group == 0 {
+		return append(buf, line[sub.Start:sub.End]...)
+	}
+	if 2*group+1 >= len(sub.Groups) || sub.Groups[2*group] < 0 {
+		return buf
+	}
+	return append(buf, line[sub.Groups[2*group]:sub.Groups[2*group+1]]...)
+}
+
+// TemplatePrinter выводит строки по пользовательскому шаблону --format.
+// Если шаблон использует данные вхождения ({match}, {col}, группы),
+// строка выводится для каждого вхождения отдельно.
+type TemplatePrinter struct {
+	writer      *bufio.Writer
+	errWriter   io.Writer
+	template    *Template
+	matchesOnly bool // не выводить контекстные строки
+	buf         []byte
+}
+
+// NewTemplatePrinter - создаёт TemplatePrinter, пишущий в writer; ошибки по файлам пишутся в errWriter
+func NewTemplatePrinter(writer, errWriter io.Writer, template *Template) *TemplatePrinter {
+	return &TemplatePrinter{
+		writer:    bufio.NewWriter(writer),
+		errWriter: errWriter,
+		template:  template,
+	}
+}
+
+// NewVimgrepPrinter - создаёт TemplatePrinter для --vimgrep: каждое вхождение
+// выводится отдельной строкой path:line:col:text, контекст не выводится.
+// При null после имени файла вместо ':' выводится нулевой байт.
+func NewVimgrepPrinter(writer, errWriter io.Writer, runes, null bool) *TemplatePrinter {
+	format := "{path}:{line}:{col}:{text}"
+	if null {
+		format = "{path}\\0{line}:{col}:{text}"
+	}
+	template, _ := ParseTemplate(format, nil)
+	template.CountRunes(runes)
+
+	p := NewTemplatePrinter(writer, errWriter, template)
+	p.matchesOnly = true
+	return p
+}
+
+// PrintFile - выводит строки файла по шаблону
+func (p *TemplatePrinter) PrintFile(res models.FileResult) error {
+	if err := printFileError(p.errWriter, res); err != nil {
+		return err
+	}
+
+	perMatch := p.template.usesMatch()
+	for _, m := range res.Matches {
+		if p.matchesOnly && m.Kind == models.KindContext {
+			continue
+		}
+		if !perMatch || len(m.Submatches) == 0 {
+			if err := p.render(m, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		for i := range m.Submatches {
+			if err := p.render(m, &m.Submatches[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *TemplatePrinter) render(m models.Match, sub *models.Submatch) error {
+	p.buf = p.template.Render(p.buf[:0], m, sub)
+	p.buf = append(p.buf, '\n')
+	_, err := p.writer.Write(p.buf)
+	return err
+}
+
+// Flush - сбрасывает буфер вывода
+func (p *TemplatePrinter) Flush() error {
+	return p.writer.Flush()
+}
+
+// Finish - сбрасывает буфер вывода
+func (p *TemplatePrinter) Finish() error {
+	return p.writer.Flush()
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+)
+
+func TestTemplateRender(t *testing.T) {
+	// "user=bob id=42": вхождение user=(\w+) id=(?P<id>\d+) занимает всю строку
+	m := models.Match{FilePath: "a.log", LineNumber: 7, ByteOffset: 100, Line: []byte("user=bob id=42"), Kind: models.KindMatch}
+	sub := models.Submatch{Start: 0, End: 14, Groups: []int{0, 14, 5, 8, 12, 14}, Replacement: []byte("bob:42"), Distance: 1}
+	groups := []string{"", "", "id"}
+
+	tests := []struct {
+		format string
+		sub    *models.Submatch
+		want   string
+	}{
+		{"{path}:{line}:{col}: {text}", &sub, "a.log:7:1: user=bob id=42"},
+		{"{offset} {match}", &sub, "100 user=bob id=42"},
+		{"{1}/{id}/{2}/{0}", &sub, "bob/42/42/user=bob id=42"},
+		{"{replacement} d={distance}", &sub, "bob:42 d=1"},
+		{`{{literal}}\t{line}\\`, &sub, "{literal}\t7\\"},
+		{`{path}\0{line}`, nil, "a.log\x007"},
+		// Строка без вхождения: поля вхождения пустые, колонка - начало строки
+		{"{line}:{col}:[{match}]:[{1}]", nil, "7:1:[]:[]"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseTemplate(tt.format, groups)
+		if err != nil {
+			t.Errorf("ParseTemplate(%q): %v", tt.format, err)
+			continue
+		}
+		if got := string(tmpl.Render(nil, m, tt.sub)); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateColumnRunes(t *testing.T) {
+	m := models.Match{Line: []byte("ключ=значение")}
+	sub := models.Submatch{Start: len("ключ="), End: len("ключ=значение")}
+	tmpl, err := ParseTemplate("{col}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(tmpl.Render(nil, m, &sub)); got != "10" {
+		t.Errorf("byte column = %s, want 10", got)
+	}
+	tmpl.CountRunes(true)
+	if got := string(tmpl.Render(nil, m, &sub)); got != "6" {
+		t.Errorf("rune column = %s, want 6", got)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for _, format := range []string{"{path", "{nope}", "{3}", "{line}:{name}"} {
+		if _, err := ParseTemplate(format, []string{"", "x"}); err == nil {
+			t.Errorf("ParseTemplate(%q) accepted an invalid format", format)
+		}
+	}
+}
+
+func TestTemplatePrinterPerMatch(t *testing.T) {
+	tmpl, err := ParseTemplate("{line}:{col}:{match}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	p := NewTemplatePrinter(&out, io.Discard, tmpl)
+	res := models.FileResult{Matches: []models.Match{
+		{LineNumber: 1, Line: []byte("ctx"), Kind: models.KindContext},
+		{LineNumber: 2, Line: []byte("a-a"), Kind: models.KindMatch, Submatches: []models.Submatch{{Start: 0, End: 1}, {Start: 2, End: 3}}},
+	}}
+	if err := p.PrintFile(res); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	// Шаблон с данными вхождения выводится для каждого вхождения, контекст - один раз
+	if want := "1:1:\n2:1:a\n2:3:a\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
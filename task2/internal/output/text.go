@@ -0,0 +1,132 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// TextPrinter выводит результаты в привычном для grep текстовом виде
+type TextPrinter struct {
+	writer       *bufio.Writer
+	errWriter    io.Writer
+	flags        *options.FlagStruct
+	withFilename bool
+}
+
+// NewTextPrinter - создаёт TextPrinter, пишущий в writer; ошибки по файлам пишутся в errWriter
+func NewTextPrinter(writer, errWriter io.Writer, fs *options.FlagStruct, withFilename bool) *TextPrinter {
+	return &TextPrinter{
+		writer:       bufio.NewWriter(writer),
+		errWriter:    errWriter,
+		flags:        fs,
+		withFilename: withFilename,
+	}
+}
+
+// PrintFile - выводит строки файла с префиксами (имя файла, номер строки) либо количество совпадений при -c
+func (p *TextPrinter) PrintFile(res models.FileResult) error {
+	if err := printFileError(p.errWriter, res); err != nil {
+		return err
+	}
+
+	// Если флаг -c, просто считаем совпадения
+	if *p.flags.SmallCFlag {
+		count := 0
+		for _, m := range res.Matches {
+			if m.Kind == models.KindMatch {
+				count++
+			}
+		}
+		if p.withFilename {
+			p.writeFilename(res.FilePath, ':')
+		}
+		_, err := fmt.Fprintf(p.writer, "%d\n", count)
+		return err
+	}
+
+	for _, m := range res.Matches {
+		if err := p.printLine(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printLine - выводит одну строку; совпадения отделяются ':', контекст - '-'.
+// При -o выводится каждое вхождение отдельно, контекст не выводится
+func (p *TextPrinter) printLine(m models.Match) error {
+	if *p.flags.OnlyMatchingFlag {
+		if m.Kind == models.KindContext {
+			return nil
+		}
+		for _, sub := range m.Submatches {
+			p.writePrefix(m, ':', sub.Start)
+			if sub.Replacement != nil {
+				p.writer.Write(sub.Replacement)
+			} else {
+				p.writer.Write(m.Line[sub.Start:sub.End])
+			}
+			if p.flags.Fuzzy() {
+				// Для приближённого поиска через табуляцию выводится число правок
+				p.writer.WriteByte('\t')
+				p.writer.WriteString(strconv.Itoa(sub.Distance))
+			}
+			if err := p.writer.WriteByte('\n'); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	sep := byte(':')
+	if m.Kind == models.KindContext {
+		sep = '-'
+	}
+	start := 0
+	if len(m.Submatches) > 0 {
+		start = m.Submatches[0].Start
+	}
+
+	p.writePrefix(m, sep, start)
+	p.writer.Write(m.Replaced())
+	return p.writer.WriteByte('\n')
+}
+
+// writePrefix - выводит имя файла, номер строки и колонку (start - смещение вхождения)
+func (p *TextPrinter) writePrefix(m models.Match, sep byte, start int) {
+	if p.withFilename {
+		p.writeFilename(m.FilePath, sep)
+	}
+	if *p.flags.NFlag || *p.flags.ColumnFlag {
+		p.writer.WriteString(strconv.Itoa(m.LineNumber))
+		p.writer.WriteByte(sep)
+	}
+	if *p.flags.ColumnFlag && m.Kind == models.KindMatch {
+		p.writer.WriteString(strconv.Itoa(column(m.Line, start, *p.flags.ColumnRunes)))
+		p.writer.WriteByte(sep)
+	}
+}
+
+// writeFilename - выводит имя файла и разделитель; при -Z вместо разделителя выводится нулевой байт
+func (p *TextPrinter) writeFilename(path string, sep byte) {
+	p.writer.WriteString(path)
+	if *p.flags.NullFlag {
+		sep = 0
+	}
+	p.writer.WriteByte(sep)
+}
+
+// Flush - сбрасывает буфер вывода
+func (p *TextPrinter) Flush() error {
+	return p.writer.Flush()
+}
+
+// Finish - сбрасывает буфер вывода
+func (p *TextPrinter) Finish() error {
+	return p.writer.Flush()
+}
@@ -0,0 +1,97 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// render - ищет по input с флагами args и выводит результат принтером, выбранным по флагам
+func render(t *testing.T, input string, filesCount int, args ...string) string {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := grep.Search(context.Background(), strings.NewReader(input), *fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.FilePath = "f.txt"
+	for i := range res.Matches {
+		res.Matches[i].FilePath = res.FilePath
+	}
+
+	var out bytes.Buffer
+	printer, err := NewPrinter(&out, io.Discard, fs, fs.WithFilename(filesCount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := printer.PrintFile(res); err != nil {
+		t.Fatal(err)
+	}
+	if err := printer.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestColumnOutput(t *testing.T) {
+	input := "no\nключ=знач знач\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		// --column включает номера строк, колонка - первого вхождения
+		{[]string{"--column", "знач"}, "2:10:ключ=знач знач\n"},
+		{[]string{"--column", "--column-runes", "знач"}, "2:6:ключ=знач знач\n"},
+		// У контекстных строк колонки нет
+		{[]string{"--column", "-B1", "знач"}, "1-no\n2:10:ключ=знач знач\n"},
+		{[]string{"--column", "-o", "знач"}, "2:10:знач\n2:19:знач\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, input, 1, tt.args...); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestVimgrepOutput(t *testing.T) {
+	input := "a b a\nctx\n"
+	// Каждое вхождение - отдельной строкой с именем файла, контекст не выводится
+	got := render(t, input, 1, "--vimgrep", "-A1", "a")
+	if want := "f.txt:1:1:a b a\nf.txt:1:5:a b a\n"; got != want {
+		t.Errorf("vimgrep = %q, want %q", got, want)
+	}
+	got = render(t, "я a\n", 1, "--vimgrep", "--column-runes", "-Z", "a")
+	if want := "f.txt\x001:3:я a\n"; got != want {
+		t.Errorf("vimgrep -Z = %q, want %q", got, want)
+	}
+}
+
+func TestFilenamePrefix(t *testing.T) {
+	input := "a\nb\n"
+	tests := []struct {
+		args  []string
+		files int
+		want  string
+	}{
+		{[]string{"a"}, 1, "a\n"},
+		{[]string{"a"}, 2, "f.txt:a\n"},
+		{[]string{"-H", "-n", "-A1", "a"}, 1, "f.txt:1:a\nf.txt-2-b\n"},
+		{[]string{"-h", "a"}, 2, "a\n"},
+		// -Z: после имени файла нулевой байт вместо разделителя, в том числе для контекста и -c
+		{[]string{"-H", "-Z", "-A1", "a"}, 1, "f.txt\x00a\nf.txt\x00b\n"},
+		{[]string{"-Z", "-c", "a"}, 2, "f.txt\x001\n"},
+	}
+	for _, tt := range tests {
+		if got := render(t, input, tt.files, tt.args...); got != tt.want {
+			t.Errorf("%q with %d files: got %q, want %q", tt.args, tt.files, got, tt.want)
+		}
+	}
+}
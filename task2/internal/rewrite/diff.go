@@ -0,0 +1,134 @@
+package rewrite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+)
+
+// diffContext - количество строк контекста вокруг изменений в diff
+const diffContext = 3
+
+// hunk - группа изменений с общим контекстом: строки исходного файла [start, end]
+type hunk struct {
+	start, end int
+	changes    []models.Match
+}
+
+// writeDiff - выводит unified diff исходного файла и его версии с заменами.
+// Контекстные строки читаются из исходного файла, который при этом не изменяется
+func writeDiff(w io.Writer, path string, changes []models.Match) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "grep: %s: %v\n", path, err)
+		}
+	}()
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "--- a/%s\n+++ b/%s\n", path, path)
+
+	hunks := groupHunks(changes)
+	reader := bufio.NewReader(file)
+	lineNumber := 0
+	shift := 0 // разница в количестве строк между новой и старой версией до текущего блока
+	original := make(map[int][]byte)
+
+	for _, h := range hunks {
+		// Читаем строки исходного файла до конца блока
+		for lineNumber < h.end {
+			raw, err := reader.ReadBytes('\n')
+			if len(raw) == 0 && err != nil {
+				break
+			}
+			lineNumber++
+			if lineNumber >= h.start {
+				original[lineNumber] = raw
+			}
+		}
+		if lineNumber < h.end {
+			h.end = lineNumber
+		}
+
+		var body bytes.Buffer
+		oldCount, newCount := 0, 0
+		next := 0
+		for n := h.start; n <= h.end; n++ {
+			raw := original[n]
+			if next < len(h.changes) && h.changes[next].LineNumber == n {
+				change := h.changes[next]
+				next++
+				writeDiffLine(&body, '-', raw)
+				oldCount++
+
+				_, ending := grep.SplitLineEnding(raw)
+				replaced := append(append([]byte{}, change.Replaced()...), ending...)
+				for _, line := range bytes.SplitAfter(replaced, []byte{'\n'}) {
+					if len(line) > 0 {
+						writeDiffLine(&body, '+', line)
+						newCount++
+					}
+				}
+				continue
+			}
+			writeDiffLine(&body, ' ', raw)
+			oldCount++
+			newCount++
+		}
+		for n := h.start; n <= h.end; n++ {
+			delete(original, n)
+		}
+
+		fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(h.start, oldCount), hunkRange(h.start+shift, newCount))
+		out.Write(body.Bytes())
+		shift += newCount - oldCount
+	}
+
+	return out.Flush()
+}
+
+// groupHunks - объединяет изменения, контекст которых пересекается, в общие блоки
+func groupHunks(changes []models.Match) []hunk {
+	var hunks []hunk
+	for _, change := range changes {
+		start := max(1, change.LineNumber-diffContext)
+		end := change.LineNumber + diffContext
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end+1 {
+			last := &hunks[len(hunks)-1]
+			last.end = end
+			last.changes = append(last.changes, change)
+			continue
+		}
+		hunks = append(hunks, hunk{start: start, end: end, changes: []models.Match{change}})
+	}
+	return hunks
+}
+
+// writeDiffLine - выводит строку diff с префиксом; строка без перевода строки
+// в конце файла помечается как в diff -u
+func writeDiffLine(w *bytes.Buffer, prefix byte, raw []byte) {
+	w.WriteByte(prefix)
+	w.Write(raw)
+	if !bytes.HasSuffix(raw, []byte{'\n'}) {
+		w.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// hunkRange - диапазон строк в заголовке блока
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
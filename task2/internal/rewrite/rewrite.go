@@ -0,0 +1,124 @@
+// Package rewrite содержит атомарную перезапись файлов для операции replace:
+// новое содержимое пишется во временный файл рядом с исходным и затем переименовывается
+package rewrite
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/models"
+)
+
+// Options - параметры перезаписи
+type Options struct {
+	Backup string    // суффикс резервной копии исходного файла ("" - без копии)
+	DryRun bool      // не изменять файл, а вывести unified diff
+	Diff   io.Writer // куда выводить diff при DryRun
+}
+
+// File - перезапись одного файла. Содержимое дописывается по частям
+// (чанк за чанком) в исходном порядке
+type File struct {
+	path    string
+	opts    Options
+	tmp     *os.File
+	changes []models.Match
+	lines   int // количество строк, уже записанных предыдущими частями
+}
+
+// Create - начинает перезапись файла path; при DryRun временный файл не создаётся
+func Create(path string, opts Options) (*File, error) {
+	f := &File{path: path, opts: opts}
+	if opts.DryRun {
+		return f, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".mygrep-*")
+	if err != nil {
+		return nil, err
+	}
+	f.tmp = tmp
+	return f, nil
+}
+
+// Write - дописывает очередную часть файла. changes - изменённые строки части
+// с номерами от её начала, lineCount - количество строк в части
+func (f *File) Write(data []byte, changes []models.Match, lineCount int) error {
+	for _, change := range changes {
+		change.LineNumber += f.lines
+		f.changes = append(f.changes, change)
+	}
+	f.lines += lineCount
+
+	if f.tmp == nil {
+		return nil
+	}
+	_, err := f.tmp.Write(data)
+	return err
+}
+
+// Commit - завершает перезапись: при DryRun выводит diff, иначе заменяет исходный
+// файл временным (с резервной копией, если задан суффикс). Если ничего не изменилось,
+// файл остаётся нетронутым
+func (f *File) Commit() error {
+	if f.opts.DryRun {
+		if len(f.changes) == 0 {
+			return nil
+		}
+		return writeDiff(f.opts.Diff, f.path, f.changes)
+	}
+
+	if len(f.changes) == 0 {
+		f.Abort()
+		return nil
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.tmp.Chmod(info.Mode().Perm()); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.tmp.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.tmp.Close(); err != nil {
+		f.Abort()
+		return err
+	}
+
+	if f.opts.Backup != "" {
+		backup := f.path + f.opts.Backup
+		if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+			f.Abort()
+			return err
+		}
+		// Жёсткая ссылка: исходное имя не пропадает ни на момент
+		if err := os.Link(f.path, backup); err != nil {
+			f.Abort()
+			return fmt.Errorf("cannot create backup %s: %v", backup, err)
+		}
+	}
+
+	if err := os.Rename(f.tmp.Name(), f.path); err != nil {
+		f.Abort()
+		return err
+	}
+	return nil
+}
+
+// Abort - отменяет перезапись и удаляет временный файл
+func (f *File) Abort() {
+	if f.tmp == nil {
+		return
+	}
+	_ = f.tmp.Close()
+	_ = os.Remove(f.tmp.Name())
+	f.tmp = nil
+}
@@ -0,0 +1,157 @@
+package rewrite_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/grep"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+	"github.com/pozedorum/WB_project_4/task2/internal/rewrite"
+)
+
+// rewriteFile - заменяет вхождения в файле path по флагам args целиком, одной частью
+func rewriteFile(t *testing.T, path string, opts rewrite.Options, args ...string) error {
+	t.Helper()
+	fs, _, err := options.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, changed, err := grep.Replace(context.Background(), bytes.NewReader(input), *fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := rewrite.Create(path, opts)
+	if err != nil {
+		return err
+	}
+	if err := out.Write(data, changed.Matches, changed.LineCount); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Commit()
+}
+
+// checkContent - содержимое файла path
+func checkContent(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", filepath.Base(path), got, want)
+	}
+}
+
+// checkNoTemp - во временном каталоге не осталось временных файлов перезаписи
+func checkNoTemp(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".mygrep-") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestCommitReplacesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "conf")
+	if err := os.WriteFile(path, []byte("host=a\r\nport=1\nhost=b"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rewriteFile(t, path, rewrite.Options{Backup: ".orig"}, "--in-place", "-r", "server=$1", `host=(\w)`); err != nil {
+		t.Fatal(err)
+	}
+	// Окончания строк сохраняются, в том числе отсутствие перевода строки в конце
+	checkContent(t, path, "server=a\r\nport=1\nserver=b")
+	checkContent(t, path+".orig", "host=a\r\nport=1\nhost=b")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+	checkNoTemp(t, dir)
+}
+
+func TestCommitWithoutChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "conf")
+	if err := os.WriteFile(path, []byte("port=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rewriteFile(t, path, rewrite.Options{Backup: ".orig"}, "--in-place", "-r", "x", "host"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("file without matches was replaced")
+	}
+	if _, err := os.Stat(path + ".orig"); !os.IsNotExist(err) {
+		t.Error("backup created for a file without matches")
+	}
+	checkNoTemp(t, dir)
+}
+
+func TestDryRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	lines := []string{"1", "2", "3", "old", "5", "6", "7", "8", "9", "10", "11", "old"}
+	original := strings.Join(lines, "\n")
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var diff bytes.Buffer
+	if err := rewriteFile(t, path, rewrite.Options{DryRun: true, Diff: &diff}, "--dry-run", "-r", "new\\nline", "old"); err != nil {
+		t.Fatal(err)
+	}
+	want := "--- a/" + path + "\n+++ b/" + path + "\n" +
+		"@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-old\n+new\\nline\n 5\n 6\n 7\n" +
+		"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-old\n\\ No newline at end of file\n+new\\nline\n\\ No newline at end of file\n"
+	if diff.String() != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", diff.String(), want)
+	}
+	checkContent(t, path, original)
+	checkNoTemp(t, dir)
+}
+
+func TestAbortKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	if err := os.WriteFile(path, []byte("keep\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := rewrite.Create(path, rewrite.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Write([]byte("partial"), nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	out.Abort()
+	checkContent(t, path, "keep\n")
+	checkNoTemp(t, dir)
+}
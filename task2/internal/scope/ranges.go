@@ -0,0 +1,55 @@
+package scope
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+)
+
+// parseLineRange - разбирает --lines FIRST:LAST (номера с 1, включительно);
+// last == 0 - до конца файла
+func parseLineRange(value string) (first, last int, err error) {
+	from, to, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid --lines %q, expected FIRST:LAST", value)
+	}
+
+	first = 1
+	if from != "" {
+		if first, err = strconv.Atoi(from); err != nil || first < 1 {
+			return 0, 0, fmt.Errorf("invalid first line in --lines %q", value)
+		}
+	}
+	if to != "" {
+		if last, err = strconv.Atoi(to); err != nil || last < first {
+			return 0, 0, fmt.Errorf("invalid last line in --lines %q", value)
+		}
+	}
+	return first, last, nil
+}
+
+// parseByteRange - разбирает --bytes START:END; end == -1 - до конца файла
+func parseByteRange(value string) (start, end int64, err error) {
+	from, to, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid --bytes %q, expected START:END", value)
+	}
+
+	end = -1
+	if from != "" {
+		if start, err = chunks.ParseSize(from); err != nil {
+			return 0, 0, fmt.Errorf("invalid --bytes %q: %v", value, err)
+		}
+	}
+	if to != "" {
+		if end, err = chunks.ParseSize(to); err != nil {
+			return 0, 0, fmt.Errorf("invalid --bytes %q: %v", value, err)
+		}
+		if end < start {
+			return 0, 0, fmt.Errorf("invalid --bytes %q: end is before start", value)
+		}
+	}
+	return start, end, nil
+}
@@ -0,0 +1,84 @@
+package scope
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		value       string
+		first, last int
+	}{
+		{"10:20", 10, 20},
+		{":20", 1, 20},
+		{"10:", 10, 0},
+		{"5:5", 5, 5},
+	}
+	for _, tt := range tests {
+		first, last, err := parseLineRange(tt.value)
+		if err != nil || first != tt.first || last != tt.last {
+			t.Errorf("parseLineRange(%q) = %d, %d, %v; want %d, %d", tt.value, first, last, err, tt.first, tt.last)
+		}
+	}
+	for _, value := range []string{"10", "0:5", "5:4", "a:b", "-1:"} {
+		if _, _, err := parseLineRange(value); err == nil {
+			t.Errorf("parseLineRange(%q) accepted", value)
+		}
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		value      string
+		start, end int64
+	}{
+		{"1K:2K", 1024, 2048},
+		{":100", 0, 100},
+		{"1G:", 1 << 30, -1},
+	}
+	for _, tt := range tests {
+		start, end, err := parseByteRange(tt.value)
+		if err != nil || start != tt.start || end != tt.end {
+			t.Errorf("parseByteRange(%q) = %d, %d, %v; want %d, %d", tt.value, start, end, err, tt.start, tt.end)
+		}
+	}
+	for _, value := range []string{"100", "2K:1K", "x:", ":1Q", "99999999999T:"} {
+		if _, _, err := parseByteRange(value); err == nil {
+			t.Errorf("parseByteRange(%q) accepted", value)
+		}
+	}
+}
+
+func TestResolveLinesAndBytes(t *testing.T) {
+	data := "one\ntwo\nthree\nfour\nfive\n"
+	// Начала строк: 0, 4, 8, 14, 19; размер 24
+	tests := []struct {
+		args        []string
+		start, end  int64
+		linesBefore int
+	}{
+		{[]string{"--lines", "2:3"}, 4, 14, 1},
+		{[]string{"--lines", "4:"}, 14, 24, 3},
+		{[]string{"-n", "--bytes", "5:14"}, 8, 14, 2},
+		{[]string{"--bytes", "4:"}, 4, 24, 0},
+		// Пересечение: --bytes начинается позже, строки до начала считаются заново
+		{[]string{"-n", "--lines", "2:5", "--bytes", "9:"}, 14, 24, 3},
+		{[]string{"--lines", "2:2", "--bytes", ":100"}, 4, 8, 1},
+	}
+	for _, tt := range tests {
+		region := resolve(t, data, tt.args...)
+		if region.Start != tt.start || region.End != tt.end || region.LinesBefore != tt.linesBefore {
+			t.Errorf("%q: region %+v, want [%d, %d) after %d lines", tt.args, region, tt.start, tt.end, tt.linesBefore)
+		}
+	}
+
+	// Диапазон за концом файла пуст
+	if region := resolve(t, data, "--lines", "9:"); region.Start != 24 || region.End != 24 {
+		t.Errorf("lines past the end: %+v", region)
+	}
+	// Без -n строки до области не считаются, если они не известны из --lines
+	if region := resolve(t, strings.Repeat("x\n", 10), "--bytes", "6:"); region.LinesBefore != 0 {
+		t.Errorf("lines counted without -n: %+v", region)
+	}
+}
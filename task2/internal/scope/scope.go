@@ -0,0 +1,184 @@
+// Package scope определяет, какую часть файла нужно просматривать: по умолчанию
+// весь файл, с --since/--until - только строки из заданного промежутка времени
+// (в упорядоченных по времени журналах граница находится двоичным поиском),
+// с --lines и --bytes - заданный диапазон строк или байт. Ограничения пересекаются
+package scope
+
+import (
+	"os"
+	"time"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/chunks"
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// Region - часть файла [Start, End), начинающаяся и заканчивающаяся на границе строки
+type Region struct {
+	Start       int64
+	End         int64
+	LinesBefore int // количество строк файла до Start (0, если номера строк не выводятся)
+}
+
+// Scope - ограничения области поиска, заданные флагами
+type Scope struct {
+	parser    timeParser
+	since     *time.Time
+	until     *time.Time
+	lineCount bool // считать строки до начала области для номеров строк
+
+	firstLine int // --lines: первая строка (с 1), 0 - без ограничения
+	lastLine  int // последняя строка включительно, 0 - до конца файла
+	byteStart int64
+	byteEnd   int64 // --bytes: конец диапазона, -1 - до конца файла
+	bytesSet  bool
+
+	limits map[string]int64 // зафиксированные размеры файлов (см. Limit)
+}
+
+// New - разбирает флаги области поиска; время для относительных значений
+// (--since 1h) фиксируется в момент вызова
+func New(fs *options.FlagStruct) (*Scope, error) {
+	s := &Scope{
+		parser:    timeParser{layout: *fs.TimeFormatFlag, now: time.Now()},
+		lineCount: fs.NeedLineNumbers(),
+	}
+
+	if *fs.SinceFlag != "" {
+		t, err := s.parser.parseBound(*fs.SinceFlag)
+		if err != nil {
+			return nil, err
+		}
+		s.since = &t
+	}
+	if *fs.UntilFlag != "" {
+		t, err := s.parser.parseBound(*fs.UntilFlag)
+		if err != nil {
+			return nil, err
+		}
+		s.until = &t
+	}
+
+	var err error
+	if *fs.LinesFlag != "" {
+		if s.firstLine, s.lastLine, err = parseLineRange(*fs.LinesFlag); err != nil {
+			return nil, err
+		}
+	}
+	if *fs.BytesFlag != "" {
+		if s.byteStart, s.byteEnd, err = parseByteRange(*fs.BytesFlag); err != nil {
+			return nil, err
+		}
+		s.bytesSet = true
+	}
+	return s, nil
+}
+
+// Active - ограничена ли область поиска
+func (s *Scope) Active() bool {
+	return s.since != nil || s.until != nil || s.firstLine > 0 || s.bytesSet || len(s.limits) > 0
+}
+
+// Bounded - ограничен ли конец области поиска (--until, конец --lines или --bytes)
+func (s *Scope) Bounded() bool {
+	return s.until != nil || s.lastLine > 0 || (s.bytesSet && s.byteEnd >= 0)
+}
+
+// Limit - фиксирует размер файла path: данные, дописанные после вызова,
+// не просматриваются (их обрабатывает --follow). size должен быть границей строки
+func (s *Scope) Limit(path string, size int64) {
+	if s.limits == nil {
+		s.limits = make(map[string]int64)
+	}
+	s.limits[path] = size
+}
+
+// Resolve - область поиска в файле размера fileSize
+func (s *Scope) Resolve(file *os.File, fileSize int64) (Region, error) {
+	if limit, ok := s.limits[file.Name()]; ok {
+		fileSize = min(fileSize, limit)
+	}
+	region := Region{Start: 0, End: fileSize}
+	linesBefore := -1 // известное число строк до region.Start
+
+	if s.bytesSet {
+		// Берутся строки, начинающиеся внутри диапазона байт
+		start, err := chunks.LineStartAfter(file, fileSize, s.byteStart)
+		if err != nil {
+			return region, err
+		}
+		end := fileSize
+		if s.byteEnd >= 0 {
+			if end, err = chunks.LineStartAfter(file, fileSize, s.byteEnd); err != nil {
+				return region, err
+			}
+		}
+		region.Start, region.End = start, end
+	}
+
+	if s.firstLine > 0 {
+		start, err := chunks.SkipLines(file, fileSize, 0, s.firstLine-1)
+		if err != nil {
+			return region, err
+		}
+		end := fileSize
+		if s.lastLine > 0 {
+			if end, err = chunks.SkipLines(file, fileSize, start, s.lastLine-s.firstLine+1); err != nil {
+				return region, err
+			}
+		}
+		if start >= region.Start {
+			region.Start = start
+			linesBefore = s.firstLine - 1
+		}
+		region.End = min(region.End, end)
+	}
+
+	if s.since != nil {
+		since := *s.since
+		start, err := chunks.SearchLineOffset(file, fileSize, s.probe(func(t time.Time) bool {
+			return t.Before(since)
+		}))
+		if err != nil {
+			return region, err
+		}
+		if start > region.Start {
+			region.Start = start
+			linesBefore = -1
+		}
+	}
+	if s.until != nil {
+		until := *s.until
+		end, err := chunks.SearchLineOffset(file, fileSize, s.probe(func(t time.Time) bool {
+			return !t.After(until)
+		}))
+		if err != nil {
+			return region, err
+		}
+		region.End = min(region.End, end)
+	}
+	if region.End < region.Start {
+		region.End = region.Start
+	}
+
+	// Номера строк остаются абсолютными: считаем строки до начала области, если они не известны
+	var err error
+	switch {
+	case linesBefore >= 0:
+		region.LinesBefore = linesBefore
+	case s.lineCount && region.Start > 0:
+		region.LinesBefore, err = chunks.CountLines(file, region.Start)
+	}
+	return region, err
+}
+
+// probe - проверка строки для двоичного поиска: строки без метки времени
+// (например, продолжение многострочной записи) относятся к предыдущей
+func (s *Scope) probe(before func(t time.Time) bool) chunks.LineProbe {
+	return func(line []byte) (bool, bool) {
+		t, ok := s.parser.parse(line)
+		if !ok {
+			return false, false
+		}
+		return before(t), true
+	}
+}
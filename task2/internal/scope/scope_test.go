@@ -0,0 +1,117 @@
+package scope
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/WB_project_4/task2/internal/options"
+)
+
+// resolve - область поиска в файле с содержимым data по флагам args
+func resolve(t *testing.T, data string, args ...string) Region {
+	t.Helper()
+	fs, _, err := options.Parse(append(args, "x"))
+	if err != nil {
+		t.Fatalf("parse %q: %v", args, err)
+	}
+	s, err := New(fs)
+	if err != nil {
+		t.Fatalf("scope %q: %v", args, err)
+	}
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	region, err := s.Resolve(file, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return region
+}
+
+// secondsLog - журнал с записью в каждую секунду, начиная с start; после каждой
+// десятой записи - строки стека без метки времени
+func secondsLog(start time.Time, n int) (data string, offsets []int64) {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		offsets = append(offsets, int64(b.Len()))
+		fmt.Fprintf(&b, "%s INFO request %d handled\n", start.Add(time.Duration(i)*time.Second).Format("2006-01-02 15:04:05"), i)
+		if i%10 == 0 {
+			b.WriteString("    at handler.go:12\n    at server.go:40\n")
+		}
+	}
+	offsets = append(offsets, int64(b.Len()))
+	return b.String(), offsets
+}
+
+func TestResolveTimeRange(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	data, offsets := secondsLog(start, 5000) // больше 64KB: граница ищется двоичным поиском
+	at := func(i int) string { return start.Add(time.Duration(i) * time.Second).Format("2006-01-02T15:04:05") }
+
+	tests := []struct {
+		args       []string
+		start, end int64
+	}{
+		{[]string{"--since", at(1234)}, offsets[1234], offsets[5000]},
+		// --until включает записи с этой меткой и строки продолжения после них
+		{[]string{"--until", at(1234)}, 0, offsets[1235]},
+		{[]string{"--since", at(1230), "--until", at(1230)}, offsets[1230], offsets[1231]},
+		{[]string{"--since", at(-10), "--until", at(6000)}, 0, offsets[5000]},
+		{[]string{"--since", at(6000)}, offsets[5000], offsets[5000]},
+		// Пустой промежуток
+		{[]string{"--since", at(2000), "--until", at(1000)}, offsets[2000], offsets[2000]},
+		{[]string{"--since", "2024-05-01 10:00:30.5"}, offsets[31], offsets[5000]},
+	}
+	for _, tt := range tests {
+		region := resolve(t, data, tt.args...)
+		if region.Start != tt.start || region.End != tt.end {
+			t.Errorf("%q: region [%d, %d), want [%d, %d)", tt.args, region.Start, region.End, tt.start, tt.end)
+		}
+	}
+
+	// Номера строк остаются абсолютными: с -n считаются строки до начала области
+	region := resolve(t, data, "-n", "--since", at(1234))
+	if want := strings.Count(data[:offsets[1234]], "\n"); region.LinesBefore != want {
+		t.Errorf("lines before = %d, want %d", region.LinesBefore, want)
+	}
+}
+
+func TestParseBound(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		layout string
+		value  string
+		want   time.Time
+	}{
+		{"", "now", now},
+		{"", "90m", now.Add(-90 * time.Minute)},
+		{"", "2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+		{"", "2024-05-01 10:20", time.Date(2024, 5, 1, 10, 20, 0, 0, time.Local)},
+		{"", "2024-05-01T10:20:30Z", time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)},
+		// Значение в формате --time-format; без года берётся текущий
+		{time.Stamp, "May  3 08:00:00", time.Date(2024, 5, 3, 8, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		p := timeParser{layout: tt.layout, now: now}
+		got, err := p.parseBound(tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseBound(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+	p := timeParser{now: now}
+	for _, value := range []string{"yesterday", "2024-13-01", "1 h"} {
+		if _, err := p.parseBound(value); err == nil {
+			t.Errorf("parseBound(%q) accepted", value)
+		}
+	}
+}
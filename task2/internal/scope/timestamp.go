@@ -0,0 +1,144 @@
+package scope
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// timestampFormat - распознаваемый формат метки времени в строке журнала
+type timestampFormat struct {
+	re      *regexp.Regexp
+	layouts []string
+}
+
+// Форматы, которые распознаются без --time-format; метка ищется в начале строки
+// (для формата журналов веб-серверов - в первых квадратных скобках)
+var timestampFormats = []timestampFormat{
+	{
+		// 2024-05-01T12:30:00.123Z, 2024-05-01 12:30:00,123 +0300
+		re: regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?: ?(?:Z|[+-]\d{2}:?\d{2}))?)`),
+		layouts: []string{
+			"2006-01-02T15:04:05.999999999Z07:00",
+			"2006-01-02T15:04:05.999999999 Z07:00",
+			"2006-01-02T15:04:05.999999999Z0700",
+			"2006-01-02T15:04:05.999999999 Z0700",
+			"2006-01-02T15:04:05.999999999",
+		},
+	},
+	{
+		// 127.0.0.1 - - [01/May/2024:12:30:00 +0300] "GET / HTTP/1.1"
+		re:      regexp.MustCompile(`^[^\[]*\[(\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`),
+		layouts: []string{"02/Jan/2006:15:04:05 -0700"},
+	},
+	{
+		// May  1 12:30:00 host sshd[1]: ... (год - текущий)
+		re:      regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})`),
+		layouts: []string{time.Stamp},
+	},
+}
+
+// Форматы значений --since и --until
+var boundLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// timeParser - извлекает метку времени из строки
+type timeParser struct {
+	layout string // --time-format; пусто - автоопределение
+	now    time.Time
+}
+
+// parse - метка времени в начале строки
+func (p *timeParser) parse(line []byte) (time.Time, bool) {
+	if p.layout != "" {
+		return p.parseLayout(line)
+	}
+	for _, format := range timestampFormats {
+		m := format.re.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		// Разделители даты и времени и дробной части приводим к виду раскладок
+		text := string(m[1])
+		if len(text) > 10 && text[10] == ' ' && text[4] == '-' {
+			text = text[:10] + "T" + text[11:]
+		}
+		text = strings.Replace(text, ",", ".", 1)
+
+		for _, layout := range format.layouts {
+			if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+				return p.withYear(t, layout), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// maxLayoutGrowth - на сколько метка может быть длиннее раскладки: полные названия
+// месяцев и дней недели (September для Jan), дробная часть до наносекунд
+const maxLayoutGrowth = 16
+
+// parseLayout - метка в формате --time-format в начале строки (возможно, в скобках).
+// Длина метки не всегда совпадает с длиной раскладки (Jan и January, _2, Z07:00, .999),
+// поэтому пробуются начала строки, обрезанные на границах слов, от длинных к коротким:
+// так не теряется необязательная дробная часть секунд
+func (p *timeParser) parseLayout(line []byte) (time.Time, bool) {
+	line = bytes.TrimPrefix(line, []byte{'['})
+	for end := min(len(line), len(p.layout)+maxLayoutGrowth); end > 0; end-- {
+		if end < len(line) && !tokenBoundary(line[end-1], line[end]) {
+			continue
+		}
+		if t, err := time.ParseInLocation(p.layout, string(line[:end]), time.Local); err == nil {
+			return p.withYear(t, p.layout), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// tokenBoundary - может ли метка закончиться между байтами a и b: перед пробелом
+// либо на стыке букв и цифр с другими символами
+func tokenBoundary(a, b byte) bool {
+	return b == ' ' || b == '\t' || isWordByte(a) != isWordByte(b)
+}
+
+// isWordByte - буква, цифра или байт многобайтового символа
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// withYear - для форматов без года (syslog) подставляет текущий год
+func (p *timeParser) withYear(t time.Time, layout string) time.Time {
+	if t.Year() == 0 && !strings.Contains(layout, "06") {
+		return t.AddDate(p.now.Year(), 0, 0)
+	}
+	return t
+}
+
+// parseBound - значение --since/--until: метка времени либо длительность назад от текущего момента
+func (p *timeParser) parseBound(value string) (time.Time, error) {
+	if value == "now" {
+		return p.now, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return p.now.Add(-d), nil
+	}
+
+	layouts := boundLayouts
+	if p.layout != "" {
+		layouts = append([]string{p.layout}, layouts...)
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return p.withYear(t, layout), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected a timestamp like 2006-01-02T15:04:05 or a duration like 1h", value)
+}
@@ -0,0 +1,62 @@
+package scope
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLayout(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)
+	plus3 := time.FixedZone("", 3*3600)
+	tests := []struct {
+		layout string
+		line   string
+		want   time.Time // нулевое - метки нет
+	}{
+		{time.Stamp, "May  1 12:30:00 host sshd[1]: accepted", time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)},
+		{time.Stamp, "May 11 12:30:00 host sshd[1]: accepted", time.Date(2024, 5, 11, 12, 30, 0, 0, time.Local)},
+		{"January 2 2006 15:04", "September 3 2024 10:00 backup done", time.Date(2024, 9, 3, 10, 0, 0, 0, time.Local)},
+		{"Jan 2 2006 15:04", "Sep 3 2024 10:00 backup done", time.Date(2024, 9, 3, 10, 0, 0, 0, time.Local)},
+		{time.ANSIC, "Wed May  1 12:30:00 2024 started", time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)},
+		{time.RFC850, "Wednesday, 01-May-24 12:30:00 UTC started", time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{time.RFC3339, "2024-05-01T12:30:00Z INFO started", time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{time.RFC3339, "2024-05-01T12:30:00+03:00 INFO started", time.Date(2024, 5, 1, 12, 30, 0, 0, plus3)},
+		{time.RFC3339, "2024-05-01T12:30:00Z|INFO|started", time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{"2006-01-02 15:04:05.000", "2024-05-01 12:30:00.123 INFO", time.Date(2024, 5, 1, 12, 30, 0, 123e6, time.Local)},
+		{"2006-01-02 15:04:05.999", "2024-05-01 12:30:00.5 INFO", time.Date(2024, 5, 1, 12, 30, 0, 500e6, time.Local)},
+		{"2006-01-02 15:04:05.999", "2024-05-01 12:30:00 INFO", time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)},
+		{"02/Jan/2006:15:04:05 -0700", "[01/May/2024:12:30:00 +0300] \"GET / HTTP/1.1\"", time.Date(2024, 5, 1, 12, 30, 0, 0, plus3)},
+		{"2006-01-02", "2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+		{"2006-01-02", "    at stack.trace.line(Foo.java:12)", time.Time{}},
+		{"2006-01-02", "2024-13-01 bad month", time.Time{}},
+		{time.Stamp, "May", time.Time{}},
+		{time.Stamp, "", time.Time{}},
+	}
+	for _, tt := range tests {
+		p := timeParser{layout: tt.layout, now: now}
+		got, ok := p.parse([]byte(tt.line))
+		if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+			t.Errorf("layout %q, line %q: got %v, %v; want %v", tt.layout, tt.line, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseAutoDetected(t *testing.T) {
+	p := timeParser{now: time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)}
+	tests := []struct {
+		line string
+		want time.Time
+	}{
+		{"2024-05-01 00:00:00,060 INFO req 0 handled", time.Date(2024, 5, 1, 0, 0, 0, 60e6, time.Local)},
+		{"2024-05-01T12:30:00.5Z INFO", time.Date(2024, 5, 1, 12, 30, 0, 500e6, time.UTC)},
+		{"127.0.0.1 - - [01/May/2024:12:30:00 +0000] \"GET / HTTP/1.1\" 200", time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{"May  1 12:30:00 host sshd[1]: accepted", time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)},
+		{"    at stack.trace.line(Foo.java:12)", time.Time{}},
+	}
+	for _, tt := range tests {
+		got, ok := p.parse([]byte(tt.line))
+		if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+			t.Errorf("line %q: got %v, %v; want %v", tt.line, got, ok, tt.want)
+		}
+	}
+}